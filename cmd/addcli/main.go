@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/maolonglong/microservices-example/pkg/addclient"
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"github.com/maolonglong/microservices-example/pkg/addtransport"
+	"github.com/maolonglong/microservices-example/pkg/config"
+	"github.com/maolonglong/microservices-example/pkg/discovery"
+	_ "github.com/maolonglong/microservices-example/pkg/quota" // QUOTA_EXCEEDED, from the gateway
+)
+
+const usage = `Usage: addcli [flags] sum <a> <b>
+       addcli [flags] concat <a> <b>
+       addcli [flags] decimal <a> <b>
+       addcli [flags] eval <expr> [<name>=<value> ...]
+
+Values of eval variables are integers if they parse as such, and strings
+otherwise.
+
+Calls addsvc directly (-grpc_addr, -http_addr; the latter also takes the
+gateway, e.g. http://localhost:8080/addsvc) or through service discovery
+(-discovery).
+
+The exit status tells the outcome of the last failed call: 0 if all
+succeeded, 1 for errors without a registered reason, 2 for usage errors,
+and for service errors:
+`
+
+// Exit statuses of registered errors, sorted by code. Unlisted reasons exit
+// with 1.
+var exitCodes = map[string]int{
+	"TWO_ZEROES":              10,
+	"INT_OVERFLOW":            11,
+	"MAX_SIZE_EXCEEDED":       12,
+	"INVALID_NUMBER":          13,
+	"DIVISION_BY_ZERO":        14,
+	"RATE_LIMITED":            20,
+	"QUOTA_EXCEEDED":          21,
+	"INVALID_REQUEST":         30,
+	"UNSUPPORTED_MEDIA_TYPE":  31,
+	"UNKNOWN_MODE":            32,
+	"INVALID_EXPRESSION":      33,
+	"UNKNOWN_OPTION":          34,
+	"INVALID_UTF8":            35,
+	"IDEMPOTENCY_KEY_REUSED":  36,
+	"INVALID_IDEMPOTENCY_KEY": 37,
+	"BATCH_TOO_LARGE":         38,
+}
+
+var (
+	grpcAddr = flag.String("grpc_addr", "", "gRPC address of an addsvc instance")
+	httpAddr = flag.String("http_addr", "", "HTTP address of an addsvc instance or the gateway's addsvc prefix")
+
+	discoveryBackend = flag.String("discovery", "", "Service discovery backend to find addsvc with: "+strings.Join(discovery.Backends(), ", "))
+	discoveryTarget  = flag.String("discovery_target", "", "Consul agent address, comma separated host:port[#tag...] instances, instance file, DNS SRV domain or registry address, depending on -discovery")
+	transport        = flag.String("transport", "grpc", "Transport used with -discovery: grpc or http")
+	tags             = flag.String("tags", "", "Comma separated tags addsvc instances must carry, with -discovery")
+	encoding         = flag.String("encoding", "json", "Body encoding over HTTP: "+strings.Join(addtransport.Encodings(), ", "))
+
+	repeat      = flag.Int("n", 1, "Number of calls")
+	concurrency = flag.Int("c", 1, "Number of concurrent calls")
+	timeout     = flag.Duration("timeout", 5*time.Second, "Timeout of a single call")
+	jsonOutput  = flag.Bool("json", false, "Print one JSON object per call")
+	mode        = flag.String("mode", "", "Mode of decimal sums: bounded, int64 or big; the service's own by default")
+
+	lengthUnit    = flag.String("length_unit", "", "Unit of the length limit of concat: bytes, runes or graphemes; the service's own by default")
+	normalization = flag.String("normalization", "", "Unicode normalization of concat results: none, nfc or nfkc; the service's own by default")
+
+	idempotencyKey = flag.String("idempotency_key", "", "Idempotency key sent with every call, so that repeated calls get the result of the first")
+	cacheControl   = flag.String("cache_control", "", "Cache-Control directives sent with every call: no-cache, no-store or max-age=<seconds>")
+)
+
+type result struct {
+	Method string      `json:"method"`
+	V      interface{} `json:"v,omitempty"`
+	Error  string      `json:"error,omitempty"`
+	Reason string      `json:"reason,omitempty"`
+	Took   string      `json:"took"`
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		var reasons []string
+		for _, spec := range addservice.Errors() {
+			if _, ok := exitCodes[spec.Reason]; ok {
+				reasons = append(reasons, spec.Reason)
+			}
+		}
+		sort.Slice(reasons, func(i, j int) bool { return exitCodes[reasons[i]] < exitCodes[reasons[j]] })
+		for _, reason := range reasons {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %3d %s\n", exitCodes[reason], reason)
+		}
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	call, err := parseCall(flag.Args())
+	if err != nil || *repeat < 1 || *concurrency < 1 {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "addcli:", err)
+		}
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := addclient.Config{
+		GRPCAddr:        *grpcAddr,
+		HTTPAddr:        *httpAddr,
+		Discovery:       *discoveryBackend,
+		DiscoveryTarget: *discoveryTarget,
+		Transport:       *transport,
+		Tags:            config.SplitList(*tags),
+		Client:          addtransport.DefaultClientConfig(),
+	}
+	// Client-side limiting would only hide what the service does.
+	cfg.Client.RateLimit = addendpoint.RateLimit{Rate: math.Inf(1), Burst: 1}
+	cfg.Client.Encoding = *encoding
+	if err := cfg.Client.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "addcli:", err)
+		os.Exit(2)
+	}
+
+	svc, release, err := addclient.New(cfg, log.NewNopLogger())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "addcli:", err)
+		os.Exit(1)
+	}
+	defer release()
+
+	var (
+		mtx      sync.Mutex
+		exitCode int
+		calls    = make(chan struct{})
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range calls {
+				r := call(svc)
+				mtx.Lock()
+				printResult(r)
+				if r.Error != "" {
+					exitCode = exitCodeOf(r.Reason)
+				}
+				mtx.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < *repeat; i++ {
+		calls <- struct{}{}
+	}
+	close(calls)
+	wg.Wait()
+
+	release()
+	os.Exit(exitCode)
+}
+
+// parseCall turns the arguments into a function performing the call.
+func parseCall(args []string) (func(addservice.Service) result, error) {
+	if len(args) > 1 && args[0] == "eval" {
+		return parseEval(args[1], args[2:])
+	}
+	if len(args) != 3 {
+		return nil, errors.New("want a method and two arguments")
+	}
+	method, a, b := args[0], args[1], args[2]
+	switch method {
+	case "sum":
+		x, err := strconv.Atoi(a)
+		if err != nil {
+			return nil, fmt.Errorf("a: %w", err)
+		}
+		y, err := strconv.Atoi(b)
+		if err != nil {
+			return nil, fmt.Errorf("b: %w", err)
+		}
+		return func(svc addservice.Service) result {
+			ctx, cancel := callContext()
+			defer cancel()
+			begin := time.Now()
+			v, err := svc.Sum(ctx, x, y)
+			return newResult(method, v, err, time.Since(begin))
+		}, nil
+	case "decimal":
+		return func(svc addservice.Service) result {
+			ctx, cancel := callContext()
+			defer cancel()
+			begin := time.Now()
+			v, err := svc.SumDecimal(ctx, a, b, addservice.Mode(*mode))
+			return newResult(method, v, err, time.Since(begin))
+		}, nil
+	case "concat":
+		return func(svc addservice.Service) result {
+			ctx, cancel := callContext()
+			defer cancel()
+			begin := time.Now()
+			v, err := svc.Concat(ctx, a, b, addservice.ConcatOptions{
+				LengthUnit:    addservice.LengthUnit(*lengthUnit),
+				Normalization: addservice.Normalization(*normalization),
+			})
+			return newResult(method, v, err, time.Since(begin))
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown method %q", method)
+	}
+}
+
+func parseEval(expr string, args []string) (func(addservice.Service) result, error) {
+	vars := map[string]addservice.Value{}
+	for _, arg := range args {
+		i := strings.IndexByte(arg, '=')
+		if i < 1 {
+			return nil, fmt.Errorf("want <name>=<value>, got %q", arg)
+		}
+		name, value := arg[:i], arg[i+1:]
+		if n, err := strconv.Atoi(value); err == nil {
+			vars[name] = addservice.IntValue(n)
+		} else {
+			vars[name] = addservice.StrValue(value)
+		}
+	}
+	return func(svc addservice.Service) result {
+		ctx, cancel := callContext()
+		defer cancel()
+		begin := time.Now()
+		v, err := svc.Eval(ctx, expr, vars)
+		if v.IsStr {
+			return newResult("eval", v.Str, err, time.Since(begin))
+		}
+		return newResult("eval", v.Int, err, time.Since(begin))
+	}, nil
+}
+
+// callContext returns the context of a single call.
+func callContext() (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if *idempotencyKey != "" {
+		ctx = addservice.WithIdempotencyKey(ctx, *idempotencyKey)
+	}
+	if *cacheControl != "" {
+		ctx = addservice.WithCacheControl(ctx, addservice.ParseCacheControl(*cacheControl))
+	}
+	return context.WithTimeout(ctx, *timeout)
+}
+
+func newResult(method string, v interface{}, err error, took time.Duration) result {
+	r := result{Method: method, Took: took.String()}
+	if err != nil {
+		r.Error = err.Error()
+		if spec, ok := addservice.LookupError(err); ok {
+			r.Reason = spec.Reason
+		}
+		return r
+	}
+	r.V = v
+	return r
+}
+
+func printResult(r result) {
+	if *jsonOutput {
+		json.NewEncoder(os.Stdout).Encode(r)
+		return
+	}
+	switch {
+	case r.Error != "" && r.Reason != "":
+		fmt.Fprintf(os.Stderr, "error: %s (%s)\n", r.Error, r.Reason)
+	case r.Error != "":
+		fmt.Fprintf(os.Stderr, "error: %s\n", r.Error)
+	default:
+		fmt.Println(r.V)
+	}
+}
+
+func exitCodeOf(reason string) int {
+	if code, ok := exitCodes[reason]; ok {
+		return code
+	}
+	return 1
+}
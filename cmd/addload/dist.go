@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// distribution draws integers; payloads are built from it.
+type distribution func() int64
+
+// parseDistribution reads one of the following, drawing from r:
+//
+//	const:V
+//	uniform:MIN:MAX
+//	normal:MEAN:STDDEV
+//	zipf:S:MAX   (S > 1, values in [0, MAX], small ones most likely)
+func parseDistribution(spec string, r *rand.Rand) (distribution, error) {
+	parts := strings.Split(spec, ":")
+	params := make([]float64, 0, len(parts)-1)
+	for _, p := range parts[1:] {
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return nil, fmt.Errorf("distribution %q: %w", spec, err)
+		}
+		params = append(params, v)
+	}
+	want := map[string]int{"const": 1, "uniform": 2, "normal": 2, "zipf": 2}
+	n, ok := want[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("distribution %q: want const, uniform, normal or zipf", spec)
+	}
+	if len(params) != n {
+		return nil, fmt.Errorf("distribution %q: %s takes %d parameters", spec, parts[0], n)
+	}
+
+	switch parts[0] {
+	case "const":
+		v := int64(params[0])
+		return func() int64 { return v }, nil
+	case "uniform":
+		min, max := int64(params[0]), int64(params[1])
+		if min > max {
+			return nil, fmt.Errorf("distribution %q: min above max", spec)
+		}
+		span := uint64(max-min) + 1
+		return func() int64 {
+			if span == 0 {
+				return int64(r.Uint64())
+			}
+			return min + int64(r.Uint64()%span)
+		}, nil
+	case "normal":
+		mean, stddev := params[0], params[1]
+		return func() int64 {
+			return int64(math.Round(r.NormFloat64()*stddev + mean))
+		}, nil
+	default:
+		s, max := params[0], params[1]
+		if s <= 1 || max < 0 {
+			return nil, fmt.Errorf("distribution %q: want S > 1 and MAX >= 0", spec)
+		}
+		z := rand.NewZipf(r, s, 1, uint64(max))
+		return func() int64 { return int64(z.Uint64()) }, nil
+	}
+}
+
+const letters = "abcdefghijklmnopqrstuvwxyz"
+
+// randomString returns n random letters, or none if n is negative.
+func randomString(r *rand.Rand, n int64) string {
+	var sb strings.Builder
+	for i := int64(0); i < n; i++ {
+		sb.WriteByte(letters[r.Intn(len(letters))])
+	}
+	return sb.String()
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/maolonglong/microservices-example/pkg/addclient"
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"github.com/maolonglong/microservices-example/pkg/addtransport"
+	"github.com/maolonglong/microservices-example/pkg/config"
+	"github.com/maolonglong/microservices-example/pkg/discovery"
+	_ "github.com/maolonglong/microservices-example/pkg/quota" // QUOTA_EXCEEDED, from the gateway
+	"github.com/sony/gobreaker"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	grpcAddr = flag.String("grpc_addr", "", "gRPC address of an addsvc instance")
+	httpAddr = flag.String("http_addr", "", "HTTP address of an addsvc instance or the gateway's addsvc prefix")
+
+	discoveryBackend = flag.String("discovery", "", "Service discovery backend to find addsvc with: "+strings.Join(discovery.Backends(), ", "))
+	discoveryTarget  = flag.String("discovery_target", "", "Consul agent address, comma separated host:port[#tag...] instances, instance file, DNS SRV domain or registry address, depending on -discovery")
+	transport        = flag.String("transport", "grpc", "Transport used with -discovery: grpc or http")
+	tags             = flag.String("tags", "", "Comma separated tags addsvc instances must carry, with -discovery")
+	encoding         = flag.String("encoding", "json", "Body encoding over HTTP: "+strings.Join(addtransport.Encodings(), ", "))
+	clientBreakers   = flag.Bool("client_breakers", false, "Put circuit breakers in front of the calls, as the gateway does")
+
+	profileName = flag.String("profile", "constant", "Traffic profile: constant, ramp or burst")
+	rate        = flag.Float64("rate", 10, "Calls per second; the final rate of a ramp")
+	startRate   = flag.Float64("start_rate", 0, "Calls per second at the start of a ramp")
+	burstSize   = flag.Int("burst_size", 50, "Calls fired at once by the burst profile")
+	burstEvery  = flag.Duration("burst_every", 5*time.Second, "Interval between bursts")
+	duration    = flag.Duration("duration", 10*time.Second, "Length of the run")
+	maxInflight = flag.Int("max_inflight", 1000, "Calls in flight at most; calls beyond it are dropped and counted")
+	timeout     = flag.Duration("timeout", 5*time.Second, "Timeout of a single call")
+
+	sumRatio  = flag.Float64("sum_ratio", 0.5, "Share of Sum calls, the rest are Concat")
+	sumDist   = flag.String("sum_dist", "uniform:0:100", "Distribution of Sum operands: const:V, uniform:MIN:MAX, normal:MEAN:STDDEV or zipf:S:MAX")
+	concatLen = flag.String("concat_len", "uniform:0:5", "Distribution of the length of Concat operands, in the same format as -sum_dist")
+	seed      = flag.Int64("seed", 0, "Seed of the payload generator, 0 for a random one")
+
+	jsonOutput = flag.Bool("json", false, "Print the report as JSON")
+)
+
+func main() {
+	flag.Parse()
+	if err := runLoad(); err != nil {
+		fmt.Fprintln(os.Stderr, "addload:", err)
+		os.Exit(1)
+	}
+}
+
+func runLoad() error {
+	if *duration <= 0 || *maxInflight < 1 || *sumRatio < 0 || *sumRatio > 1 {
+		return errors.New("want a positive -duration and -max_inflight and a -sum_ratio within [0, 1]")
+	}
+	p, err := newProfile(*profileName, *rate, *startRate, *duration, *burstSize, *burstEvery)
+	if err != nil {
+		return err
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	r := rand.New(rand.NewSource(*seed))
+	operand, err := parseDistribution(*sumDist, r)
+	if err != nil {
+		return fmt.Errorf("-sum_dist: %w", err)
+	}
+	length, err := parseDistribution(*concatLen, r)
+	if err != nil {
+		return fmt.Errorf("-concat_len: %w", err)
+	}
+
+	cfg := addclient.Config{
+		GRPCAddr:        *grpcAddr,
+		HTTPAddr:        *httpAddr,
+		Discovery:       *discoveryBackend,
+		DiscoveryTarget: *discoveryTarget,
+		Transport:       *transport,
+		Tags:            config.SplitList(*tags),
+		Client:          addtransport.DefaultClientConfig(),
+	}
+	// The load is shaped here; a client-side limiter would only reshape it.
+	cfg.Client.RateLimit = addendpoint.RateLimit{Rate: math.Inf(1), Burst: 1}
+	cfg.Client.Encoding = *encoding
+	cfg.Client.DisableBreakers = !*clientBreakers
+	if err := cfg.Client.Validate(); err != nil {
+		return err
+	}
+	svc, release, err := addclient.New(cfg, log.NewNopLogger())
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var (
+		rec      = newRecorder()
+		inflight = make(chan struct{}, *maxInflight)
+		wg       sync.WaitGroup
+		begin    = time.Now()
+	)
+	run(ctx, p, *duration, func() {
+		var (
+			method string
+			call   func(ctx context.Context) error
+		)
+		if r.Float64() < *sumRatio {
+			a, b := int(operand()), int(operand())
+			method, call = "Sum", func(ctx context.Context) error {
+				_, err := svc.Sum(ctx, a, b)
+				return err
+			}
+		} else {
+			a, b := randomString(r, length()), randomString(r, length())
+			method, call = "Concat", func(ctx context.Context) error {
+				_, err := svc.Concat(ctx, a, b, addservice.ConcatOptions{})
+				return err
+			}
+		}
+
+		select {
+		case inflight <- struct{}{}:
+		default:
+			rec.drop(method)
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-inflight; wg.Done() }()
+			ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+			defer cancel()
+			callBegin := time.Now()
+			err := call(ctx)
+			rec.record(method, time.Since(callBegin), errorReason(err))
+		}()
+	})
+	wg.Wait()
+
+	rep := rec.report(time.Since(begin))
+	if *jsonOutput {
+		return rep.writeJSON(os.Stdout)
+	}
+	rep.writeText(os.Stdout)
+	return nil
+}
+
+// errorReason names err for the error breakdown: the addservice reason when
+// there is one, the gRPC code or a few well-known errors otherwise, and
+// finally the message itself.
+func errorReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	if spec, ok := addservice.LookupError(err); ok {
+		return spec.Reason
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "DEADLINE_EXCEEDED"
+	case errors.Is(err, gobreaker.ErrOpenState), strings.Contains(err.Error(), gobreaker.ErrOpenState.Error()):
+		return "CIRCUIT_OPEN"
+	}
+	if st, ok := status.FromError(err); ok && st.Code() != codes.Unknown {
+		return st.Code().String()
+	}
+	return err.Error()
+}
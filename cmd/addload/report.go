@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimited is the reason of limiter rejections, reported apart from the
+// other errors.
+const rateLimited = "RATE_LIMITED"
+
+// recorder collects the outcome of every call, per method.
+type recorder struct {
+	mtx     sync.Mutex
+	methods map[string]*methodStats
+}
+
+type methodStats struct {
+	latencies []time.Duration
+	succeeded int
+	rejected  int
+	dropped   int
+	errors    map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{methods: map[string]*methodStats{}}
+}
+
+func (r *recorder) stats(method string) *methodStats {
+	s, ok := r.methods[method]
+	if !ok {
+		s = &methodStats{errors: map[string]int{}}
+		r.methods[method] = s
+	}
+	return s
+}
+
+// record adds a finished call; reason is empty for calls that succeeded and
+// names the error otherwise.
+func (r *recorder) record(method string, took time.Duration, reason string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	s := r.stats(method)
+	s.latencies = append(s.latencies, took)
+	switch reason {
+	case "":
+		s.succeeded++
+	case rateLimited:
+		s.rejected++
+	default:
+		s.errors[reason]++
+	}
+}
+
+// drop counts a call that was never made because too many were in flight.
+func (r *recorder) drop(method string) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.stats(method).dropped++
+}
+
+// Report is the summary of a run, per method and in total.
+type Report struct {
+	Elapsed string         `json:"elapsed"`
+	Total   MethodReport   `json:"total"`
+	Methods []MethodReport `json:"methods"`
+}
+
+type MethodReport struct {
+	Method     string           `json:"method"`
+	Calls      int              `json:"calls"`
+	Throughput float64          `json:"throughput"`
+	Succeeded  int              `json:"succeeded"`
+	Rejected   int              `json:"rejected"`
+	Dropped    int              `json:"dropped"`
+	Errors     map[string]int   `json:"errors"`
+	Latency    map[string]int64 `json:"latency_us"`
+}
+
+var percentiles = []struct {
+	name string
+	q    float64
+}{
+	{"p50", 0.5},
+	{"p90", 0.9},
+	{"p99", 0.99},
+	{"p99.9", 0.999},
+	{"max", 1},
+}
+
+func (r *recorder) report(elapsed time.Duration) Report {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	names := make([]string, 0, len(r.methods))
+	for name := range r.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	total := &methodStats{errors: map[string]int{}}
+	rep := Report{Elapsed: elapsed.Round(time.Millisecond).String()}
+	for _, name := range names {
+		s := r.methods[name]
+		rep.Methods = append(rep.Methods, s.report(name, elapsed))
+		total.latencies = append(total.latencies, s.latencies...)
+		total.succeeded += s.succeeded
+		total.rejected += s.rejected
+		total.dropped += s.dropped
+		for reason, n := range s.errors {
+			total.errors[reason] += n
+		}
+	}
+	rep.Total = total.report("total", elapsed)
+	return rep
+}
+
+func (s *methodStats) report(name string, elapsed time.Duration) MethodReport {
+	sort.Slice(s.latencies, func(i, j int) bool { return s.latencies[i] < s.latencies[j] })
+	m := MethodReport{
+		Method:     name,
+		Calls:      len(s.latencies),
+		Throughput: float64(len(s.latencies)) / elapsed.Seconds(),
+		Succeeded:  s.succeeded,
+		Rejected:   s.rejected,
+		Dropped:    s.dropped,
+		Errors:     s.errors,
+		Latency:    map[string]int64{},
+	}
+	if len(s.latencies) > 0 {
+		for _, p := range percentiles {
+			i := int(math.Ceil(p.q*float64(len(s.latencies)))) - 1
+			if i < 0 {
+				i = 0
+			}
+			m.Latency[p.name] = s.latencies[i].Microseconds()
+		}
+	}
+	return m
+}
+
+func (rep Report) writeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rep)
+}
+
+func (rep Report) writeText(w io.Writer) {
+	fmt.Fprintf(w, "elapsed %s\n", rep.Elapsed)
+	for _, m := range append(rep.Methods, rep.Total) {
+		fmt.Fprintf(w, "\n%s\n", m.Method)
+		fmt.Fprintf(w, "  calls      %d (%.1f/s)\n", m.Calls, m.Throughput)
+		fmt.Fprintf(w, "  succeeded  %d%s\n", m.Succeeded, share(m.Succeeded, m.Calls))
+		fmt.Fprintf(w, "  rejected   %d%s\n", m.Rejected, share(m.Rejected, m.Calls))
+		if m.Dropped > 0 {
+			fmt.Fprintf(w, "  dropped    %d (not sent, too many in flight)\n", m.Dropped)
+		}
+		if len(m.Errors) > 0 {
+			reasons := make([]string, 0, len(m.Errors))
+			for reason := range m.Errors {
+				reasons = append(reasons, reason)
+			}
+			sort.Slice(reasons, func(i, j int) bool { return m.Errors[reasons[i]] > m.Errors[reasons[j]] })
+			fmt.Fprintln(w, "  errors")
+			for _, reason := range reasons {
+				fmt.Fprintf(w, "    %-28s %d%s\n", reason, m.Errors[reason], share(m.Errors[reason], m.Calls))
+			}
+		}
+		if len(m.Latency) > 0 {
+			var parts []string
+			for _, p := range percentiles {
+				parts = append(parts, fmt.Sprintf("%s %s", p.name, time.Duration(m.Latency[p.name])*time.Microsecond))
+			}
+			fmt.Fprintf(w, "  latency    %s\n", strings.Join(parts, "  "))
+		}
+	}
+}
+
+func share(n, of int) string {
+	if of == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%.1f%%)", 100*float64(n)/float64(of))
+}
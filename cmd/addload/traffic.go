@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// A profile tells how many calls are due by an offset into the run.
+type profile func(elapsed time.Duration) int64
+
+// newProfile returns the named traffic profile:
+//
+//	constant  rate calls per second
+//	ramp      rising linearly from startRate to rate over the run
+//	burst     rate calls per second plus burstSize calls at once at the
+//	          start of every burstEvery
+func newProfile(name string, rate, startRate float64, duration time.Duration, burstSize int, burstEvery time.Duration) (profile, error) {
+	if rate < 0 || startRate < 0 {
+		return nil, errors.New("rates must not be negative")
+	}
+	constant := func(elapsed time.Duration) int64 {
+		return int64(math.Floor(rate * elapsed.Seconds()))
+	}
+	switch name {
+	case "constant":
+		return constant, nil
+	case "ramp":
+		d := duration.Seconds()
+		return func(elapsed time.Duration) int64 {
+			t := elapsed.Seconds()
+			return int64(math.Floor(startRate*t + (rate-startRate)*t*t/(2*d)))
+		}, nil
+	case "burst":
+		if burstSize < 1 || burstEvery <= 0 {
+			return nil, errors.New("burst needs a positive burst size and interval")
+		}
+		return func(elapsed time.Duration) int64 {
+			return constant(elapsed) + (int64(elapsed/burstEvery)+1)*int64(burstSize)
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown profile %q, want constant, ramp or burst", name)
+	}
+}
+
+// tick is how often run catches up with the profile.
+const tick = time.Millisecond
+
+// run calls fire as often as p asks for until duration has passed or ctx is
+// done. Calls are fired open-loop: a slow service does not slow down the
+// schedule.
+func run(ctx context.Context, p profile, duration time.Duration, fire func()) {
+	var (
+		begin  = time.Now()
+		fired  int64
+		ticker = time.NewTicker(tick)
+	)
+	defer ticker.Stop()
+	for {
+		elapsed := time.Since(begin)
+		if elapsed >= duration {
+			return
+		}
+		for due := p(elapsed); fired < due; fired++ {
+			fire()
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
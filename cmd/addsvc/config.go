@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"github.com/maolonglong/microservices-example/pkg/config"
+	"github.com/maolonglong/microservices-example/pkg/discovery"
+	"github.com/maolonglong/microservices-example/pkg/tracing"
+)
+
+// Config is read from the -config file, then overridden by ADDSVC_*
+// environment variables and finally by flags.
+type Config struct {
+	HTTPPort int `yaml:"http_port"`
+	GRPCPort int `yaml:"grpc_port"`
+
+	Discovery       string `yaml:"discovery"`
+	DiscoveryTarget string `yaml:"discovery_target"`
+
+	AdvertiseAddr  string   `yaml:"advertise_addr"`
+	AdvertiseIface string   `yaml:"advertise_iface"`
+	Tags           []string `yaml:"tags"`
+	Version        string   `yaml:"version"`
+	Zone           string   `yaml:"zone"`
+
+	DrainDelay      time.Duration `yaml:"drain_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	Health struct {
+		Interval         time.Duration `yaml:"interval"`
+		Timeout          time.Duration `yaml:"timeout"`
+		Dependencies     []string      `yaml:"dependencies"`
+		SaturationWindow time.Duration `yaml:"saturation_window"`
+	} `yaml:"health"`
+
+	Trace struct {
+		Exporter string `yaml:"exporter"`
+		File     string `yaml:"file"`
+	} `yaml:"trace"`
+
+	Service   addservice.Config      `yaml:"service"`
+	Cache     addservice.CacheConfig `yaml:"cache"`
+	Endpoints addendpoint.Config     `yaml:"endpoints"`
+}
+
+func defaultConfig() Config {
+	var c Config
+	c.HTTPPort = 8081
+	c.GRPCPort = 9091
+	c.Discovery = "consul"
+	c.DrainDelay = 5 * time.Second
+	c.ShutdownTimeout = 15 * time.Second
+	c.Health.Interval = 5 * time.Second
+	c.Health.Timeout = 2 * time.Second
+	c.Health.SaturationWindow = 30 * time.Second
+	c.Trace.Exporter = "none"
+	c.Trace.File = "addsvc-traces.json"
+	c.Service = addservice.DefaultConfig()
+	c.Cache = addservice.DefaultCacheConfig()
+	c.Endpoints = addendpoint.DefaultConfig()
+	return c
+}
+
+func (c *Config) Validate() error {
+	if c.HTTPPort <= 0 || c.GRPCPort <= 0 {
+		return errors.New("http_port and grpc_port must be positive")
+	}
+	if c.Health.Interval <= 0 || c.Health.Timeout <= 0 {
+		return errors.New("health: interval and timeout must be positive")
+	}
+	if c.Health.SaturationWindow < 0 {
+		return errors.New("health: saturation_window must not be negative")
+	}
+	if err := c.Service.Validate(); err != nil {
+		return fmt.Errorf("service: %w", err)
+	}
+	if err := c.Cache.Validate(); err != nil {
+		return fmt.Errorf("cache: %w", err)
+	}
+	if err := c.Endpoints.Validate(); err != nil {
+		return fmt.Errorf("endpoints: %w", err)
+	}
+	return nil
+}
+
+// checkReload rejects a new config that changes more than what can be
+// applied without a restart.
+func (c *Config) checkReload(next Config) error {
+	next.Service = c.Service
+	next.Cache = c.Cache
+	next.Endpoints = c.Endpoints
+	if !reflect.DeepEqual(*c, next) {
+		return errors.New("only the service, cache and endpoints sections can change without a restart")
+	}
+	return nil
+}
+
+// loadConfig builds the Config from the -config file, the environment and
+// the command line flags.
+func loadConfig(errorHandling flag.ErrorHandling) (Config, string, error) {
+	cfg := defaultConfig()
+	fs := flag.NewFlagSet(os.Args[0], errorHandling)
+	path := fs.String("config", os.Getenv("ADDSVC_CONFIG"), "YAML or JSON configuration file, watched for changes of the service, cache and endpoints sections")
+	cfg.flags(fs)
+	err := config.Load(fs, os.Args[1:], path, "ADDSVC", &cfg)
+	return cfg, *path, err
+}
+
+func (c *Config) flags(fs *flag.FlagSet) {
+	fs.IntVar(&c.HTTPPort, "http_port", c.HTTPPort, "HTTP listen address")
+	fs.IntVar(&c.GRPCPort, "grpc_port", c.GRPCPort, "gRPC listen address")
+
+	fs.StringVar(&c.Discovery, "discovery", c.Discovery, "Service discovery backend: "+strings.Join(discovery.Backends(), ", "))
+	fs.StringVar(&c.DiscoveryTarget, "discovery_target", c.DiscoveryTarget, "Consul agent address, comma separated host:port[#tag...] instances, instance file, DNS SRV domain or registry address, depending on -discovery")
+
+	fs.StringVar(&c.AdvertiseAddr, "advertise_addr", c.AdvertiseAddr, "Address registered with service discovery, detected from the network interfaces if empty")
+	fs.StringVar(&c.AdvertiseIface, "advertise_iface", c.AdvertiseIface, "Network interface to take the advertise address from")
+	config.ListVar(fs, &c.Tags, "tags", "Comma separated tags added to the registrations")
+	fs.StringVar(&c.Version, "service_version", c.Version, "Version announced in the registration metadata")
+	fs.StringVar(&c.Zone, "zone", c.Zone, "Zone announced in the registration metadata")
+
+	fs.DurationVar(&c.DrainDelay, "drain_delay", c.DrainDelay, "Time between deregistering and closing the listeners on shutdown, for clients to notice")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown_timeout", c.ShutdownTimeout, "Deadline for in-flight requests to finish on shutdown")
+
+	fs.DurationVar(&c.Health.Interval, "health_interval", c.Health.Interval, "Interval between health check runs")
+	fs.DurationVar(&c.Health.Timeout, "health_timeout", c.Health.Timeout, "Timeout of a single health check")
+	fs.DurationVar(&c.Health.SaturationWindow, "health_saturation_window", c.Health.SaturationWindow, "How long a rate limiter must stay saturated before readiness fails, 0 to never fail")
+	config.ListVar(fs, &c.Health.Dependencies, "health_dependencies", "Comma separated downstream dependencies required for readiness: http(s) URLs or gRPC host:port/service targets")
+
+	fs.IntVar(&c.Cache.MaxEntries, "cache_max_entries", c.Cache.MaxEntries, "Number of Sum and Concat results kept in memory, 0 to turn caching off")
+	fs.DurationVar(&c.Cache.TTL, "cache_ttl", c.Cache.TTL, "Time Sum and Concat results are kept in memory")
+	fs.DurationVar(&c.Cache.Timeout, "cache_timeout", c.Cache.Timeout, "Timeout of the calls filling the cache of Sum and Concat results")
+
+	fs.StringVar(&c.Trace.Exporter, "trace_exporter", c.Trace.Exporter, "Trace exporter: none, "+strings.Join(tracing.Exporters(), ", "))
+	fs.StringVar(&c.Trace.File, "trace_file", c.Trace.File, "Output file of the file trace exporter")
+}
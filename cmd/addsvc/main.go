@@ -7,32 +7,37 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/go-kit/kit/log"
-	consulsd "github.com/go-kit/kit/sd/consul"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/prometheus"
+	"github.com/go-kit/kit/sd"
 	kitgrpc "github.com/go-kit/kit/transport/grpc"
 	"github.com/google/uuid"
-	"github.com/hashicorp/consul/api"
 	"github.com/maolonglong/microservices-example/pb"
 	"github.com/maolonglong/microservices-example/pkg/addendpoint"
 	"github.com/maolonglong/microservices-example/pkg/addservice"
 	"github.com/maolonglong/microservices-example/pkg/addtransport"
+	"github.com/maolonglong/microservices-example/pkg/config"
+	"github.com/maolonglong/microservices-example/pkg/discovery"
+	"github.com/maolonglong/microservices-example/pkg/health"
+	"github.com/maolonglong/microservices-example/pkg/tracing"
 	"github.com/oklog/run"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cast"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/health"
+	grpchealth "google.golang.org/grpc/health"
 	"google.golang.org/grpc/health/grpc_health_v1"
-)
-
-var (
-	httpPort = flag.Int("http_port", 8081, "HTTP listen address")
-	grpcPort = flag.Int("grpc_port", 9091, "gRPC listen address")
+	"google.golang.org/grpc/reflection"
 )
 
 func main() {
-	flag.Parse()
-
 	var logger log.Logger
 	{
 		logger = log.NewLogfmtLogger(os.Stderr)
@@ -40,16 +45,218 @@ func main() {
 		logger = log.With(logger, "caller", log.DefaultCaller)
 	}
 
+	cfg, configFile, err := loadConfig(flag.ExitOnError)
+	if err != nil {
+		logger.Log("during", "loadConfig", "err", err)
+		os.Exit(1)
+	}
+
+	tracerProvider, err := tracing.NewTracerProvider("addsvc", cfg.Trace.Exporter, cfg.Trace.File)
+	if err != nil {
+		logger.Log("during", "NewTracerProvider", "err", err)
+		os.Exit(1)
+	}
+	defer tracerProvider.Shutdown(context.Background())
+	tracer := tracerProvider.Tracer("addsvc")
+
+	var requests, failures, rejections, cacheLookups metrics.Counter
+	{
+		requests = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "addsvc",
+			Subsystem: "service",
+			Name:      "requests_total",
+			Help:      "Total number of requests handled by the service.",
+		}, []string{"method"})
+		failures = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "addsvc",
+			Subsystem: "service",
+			Name:      "errors_total",
+			Help:      "Total number of requests that failed, by error reason.",
+		}, []string{"method", "reason"})
+		rejections = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "addsvc",
+			Subsystem: "endpoint",
+			Name:      "rate_limited_total",
+			Help:      "Total number of requests rejected by the rate limiter.",
+		}, []string{"method"})
+		cacheLookups = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "addsvc",
+			Subsystem: "service",
+			Name:      "cache_lookups_total",
+			Help:      "Total number of result cache lookups, by result: hit, miss or bypass.",
+		}, []string{"method", "result"})
+	}
+	var serviceDuration, endpointDuration metrics.Histogram
+	{
+		serviceDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "addsvc",
+			Subsystem: "service",
+			Name:      "request_duration_seconds",
+			Help:      "Service method latency in seconds.",
+		}, []string{"method", "success"})
+		endpointDuration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "addsvc",
+			Subsystem: "endpoint",
+			Name:      "request_duration_seconds",
+			Help:      "Endpoint latency in seconds, including rate limiting.",
+		}, []string{"method", "success"})
+	}
+
+	// The rate limiters of the endpoints sit in front of the cache of the
+	// service, so cached results still spend tokens: the limits bound the
+	// requests an instance takes, whatever they cost.
 	var (
-		service     = addservice.New(logger)
-		endpoints   = addendpoint.New(service, logger)
-		httpHandler = addtransport.NewHTTPHandler(endpoints, logger)
+		limits      = addservice.NewLimits(cfg.Service)
+		limiters    = addendpoint.NewLimiters(cfg.Endpoints)
+		cache       = addservice.NewCache(cfg.Cache, cacheLookups)
+		idempotency = addendpoint.NewIdempotencyStore(cfg.Endpoints.Idempotency)
+		service     = addservice.New(limits, cache, logger, requests, failures, serviceDuration, tracer)
+		endpoints   = addendpoint.New(service, logger, endpointDuration, rejections, tracer, limiters, idempotency)
+		httpHandler = addtransport.NewHTTPHandler(endpoints, logger, tracer)
 		grpcServer  = addtransport.NewGRPCServer(endpoints, logger)
 	)
 
+	// Readiness covers everything that should keep traffic away for a while:
+	// a rate limiter saturated for longer than health.saturation_window, an
+	// unreachable dependency or a shutdown in progress. A single request can
+	// empty a small bucket, which only shows in the metrics. Liveness has no
+	// checks of its own yet.
+	shuttingDown := &health.ShutdownChecker{}
+	checks := health.New(cfg.Health.Interval, cfg.Health.Timeout, log.With(logger, "component", "health"))
+	checks.Add(health.Readiness, "shutdown", shuttingDown)
+	for method, lim := range map[string]*rate.Limiter{
+		"Sum":       limiters.Sum,
+		"Concat":    limiters.Concat,
+		"Eval":      limiters.Eval,
+		"BatchSum":  limiters.BatchSum,
+		"SumStream": limiters.SumStream,
+	} {
+		stdprometheus.MustRegister(stdprometheus.NewGaugeFunc(stdprometheus.GaugeOpts{
+			Namespace:   "addsvc",
+			Subsystem:   "endpoint",
+			Name:        "rate_limit_tokens",
+			Help:        "Tokens left in the rate limiter; below 1 the next request is rejected.",
+			ConstLabels: stdprometheus.Labels{"method": method},
+		}, lim.Tokens))
+		if cfg.Health.SaturationWindow > 0 {
+			checks.Add(health.Readiness, "rate_limiter:"+method, health.LimiterChecker(lim, cfg.Health.SaturationWindow))
+		}
+	}
+	for _, dep := range cfg.Health.Dependencies {
+		checks.Add(health.Readiness, "dependency:"+dep, health.DependencyChecker(dep))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/health", checks.Handler(health.Readiness))
+	mux.Handle("/health/ready", checks.Handler(health.Readiness))
+	mux.Handle("/health/live", checks.Handler(health.Liveness))
+	mux.Handle("/", httpHandler)
+
+	backend, err := discovery.New(cfg.Discovery, cfg.DiscoveryTarget, logger)
+	if err != nil {
+		logger.Log("during", "discovery.New", "err", err)
+		os.Exit(1)
+	}
+
+	addr, err := discovery.AdvertiseAddr(cfg.AdvertiseAddr, cfg.AdvertiseIface)
+	if err != nil {
+		logger.Log("during", "AdvertiseAddr", "err", err)
+		os.Exit(1)
+	}
+
+	// Every transport is registered on its own, tagged with its protocol, so
+	// that clients can pick the one they speak.
+	var registrars []sd.Registrar
+	{
+		id := uuid.NewString()
+		meta := map[string]string{
+			"http_port": strconv.Itoa(cfg.HTTPPort),
+			"grpc_port": strconv.Itoa(cfg.GRPCPort),
+		}
+		if cfg.Version != "" {
+			meta["version"] = cfg.Version
+		}
+		if cfg.Zone != "" {
+			meta["zone"] = cfg.Zone
+		}
+		for _, r := range []discovery.Registration{
+			{
+				ID:         id + "-grpc",
+				Port:       cfg.GRPCPort,
+				Tags:       append(append([]string(nil), cfg.Tags...), "grpc"),
+				HealthGRPC: net.JoinHostPort(addr, strconv.Itoa(cfg.GRPCPort)) + "/addsvc",
+			},
+			{
+				ID:         id + "-http",
+				Port:       cfg.HTTPPort,
+				Tags:       append(append([]string(nil), cfg.Tags...), "http"),
+				HealthHTTP: fmt.Sprintf("http://%s/health", net.JoinHostPort(addr, strconv.Itoa(cfg.HTTPPort))),
+			},
+		} {
+			r.Name = "addsvc"
+			r.Address = addr
+			r.Meta = meta
+			registrar, err := backend.Registrar(r)
+			if err != nil {
+				logger.Log("during", "Registrar", "err", err)
+				os.Exit(1)
+			}
+			registrars = append(registrars, registrar)
+		}
+	}
+
+	baseServer := grpc.NewServer(grpc.UnaryInterceptor(kitgrpc.Interceptor))
+	pb.RegisterAddServiceServer(baseServer, grpcServer)
+
+	healthServer := grpchealth.NewServer()
+	grpc_health_v1.RegisterHealthServer(baseServer, healthServer)
+	reflection.Register(baseServer)
+	checks.Refresh(context.Background())
+	checks.Watch(health.GRPCUpdater(healthServer, "", "addsvc"))
+
+	httpServer := &http.Server{Handler: mux}
+
+	// shutdown takes the instance out of rotation before it stops serving:
+	// deregister, fail health checks, give clients time to notice, and only
+	// then drain in-flight requests, up to a hard deadline. It runs once, no
+	// matter which actor of the run group triggers it.
+	var shutdownOnce sync.Once
+	shutdown := func() {
+		shutdownOnce.Do(func() {
+			for _, registrar := range registrars {
+				registrar.Deregister()
+			}
+			shuttingDown.Begin()
+			checks.Refresh(context.Background())
+			healthServer.Shutdown()
+			logger.Log("during", "shutdown", "drain_delay", cfg.DrainDelay)
+			time.Sleep(cfg.DrainDelay)
+
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+			defer cancel()
+
+			grpcStopped := make(chan struct{})
+			go func() {
+				baseServer.GracefulStop()
+				close(grpcStopped)
+			}()
+			if err := httpServer.Shutdown(ctx); err != nil {
+				logger.Log("transport", "HTTP", "during", "Shutdown", "err", err)
+				httpServer.Close()
+			}
+			select {
+			case <-grpcStopped:
+			case <-ctx.Done():
+				logger.Log("transport", "gRPC", "during", "GracefulStop", "err", ctx.Err())
+				baseServer.Stop()
+			}
+		})
+	}
+
 	var g run.Group
 	{
-		httpAddr := ":" + cast.ToString(*httpPort)
+		httpAddr := ":" + cast.ToString(cfg.HTTPPort)
 		httpListener, err := net.Listen("tcp", httpAddr)
 		if err != nil {
 			logger.Log("transport", "HTTP", "during", "Listen", "err", err)
@@ -57,13 +264,16 @@ func main() {
 		}
 		g.Add(func() error {
 			logger.Log("transport", "HTTP", "addr", httpAddr)
-			return http.Serve(httpListener, httpHandler)
+			if err := httpServer.Serve(httpListener); err != http.ErrServerClosed {
+				return err
+			}
+			return nil
 		}, func(error) {
-			httpListener.Close()
+			shutdown()
 		})
 	}
 	{
-		grpcAddr := ":" + cast.ToString(*grpcPort)
+		grpcAddr := ":" + cast.ToString(cfg.GRPCPort)
 		grpcListener, err := net.Listen("tcp", grpcAddr)
 		if err != nil {
 			logger.Log("transport", "gRPC", "during", "Listen", "err", err)
@@ -71,57 +281,57 @@ func main() {
 		}
 		g.Add(func() error {
 			logger.Log("transport", "gRPC", "addr", grpcAddr)
-			baseServer := grpc.NewServer(grpc.UnaryInterceptor(kitgrpc.Interceptor))
-			pb.RegisterAddServiceServer(baseServer, grpcServer)
-
-			healthServer := health.NewServer()
-			healthServer.SetServingStatus("addsvc", grpc_health_v1.HealthCheckResponse_SERVING)
-			grpc_health_v1.RegisterHealthServer(baseServer, healthServer)
-
 			return baseServer.Serve(grpcListener)
 		}, func(error) {
-			grpcListener.Close()
+			shutdown()
 		})
 	}
 
-	g.Add(run.SignalHandler(context.Background(), syscall.SIGINT, syscall.SIGTERM))
+	{
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return checks.Run(ctx)
+		}, func(error) {
+			cancel()
+		})
+	}
 
-	var client consulsd.Client
 	{
-		consulClient, err := api.NewClient(api.DefaultConfig())
-		if err != nil {
-			logger.Log("err", err)
-			os.Exit(1)
+		// Only the limits and the cache can change at runtime. A config that fails to load
+		// or touches anything else is rejected as a whole, and the one in use
+		// stays in effect.
+		current := cfg
+		reload := func() {
+			next, _, err := loadConfig(flag.ContinueOnError)
+			if err == nil {
+				err = current.checkReload(next)
+			}
+			if err != nil {
+				logger.Log("during", "reload", "err", err)
+				return
+			}
+			limits.Set(next.Service)
+			cache.Update(next.Cache)
+			limiters.Update(next.Endpoints)
+			idempotency.Update(next.Endpoints.Idempotency)
+			current = next
+			logger.Log("during", "reload", "config", configFile)
 		}
-		client = consulsd.NewClient(consulClient)
-	}
-
-	registrar := consulsd.NewRegistrar(
-		client,
-		&api.AgentServiceRegistration{
-			ID:   uuid.NewString(),
-			Name: "addsvc",
-			// Port:    *httpPort,
-			Port:    *grpcPort,
-			Address: "localhost",
-			Checks: api.AgentServiceChecks{
-				{
-					Interval: "5s",
-					Timeout:  "2s",
-					HTTP:     fmt.Sprintf("http://localhost:%d/health", *httpPort),
-				},
-				{
-					Interval: "5s",
-					Timeout:  "2s",
-					GRPC:     fmt.Sprintf("localhost:%d/addsvc", *grpcPort),
-				},
-			},
-		},
-		logger,
-	)
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return config.Watch(ctx, configFile, reload)
+		}, func(error) {
+			cancel()
+		})
+	}
 
-	registrar.Register()
-	defer registrar.Deregister()
+	g.Add(run.SignalHandler(context.Background(), syscall.SIGINT, syscall.SIGTERM))
+
+	// Nothing below may exit the process without running shutdown, or the
+	// instance would stay registered.
+	for _, registrar := range registrars {
+		registrar.Register()
+	}
 
 	logger.Log("exit", g.Run())
 }
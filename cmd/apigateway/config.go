@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"github.com/maolonglong/microservices-example/pkg/addtransport"
+	"github.com/maolonglong/microservices-example/pkg/config"
+	"github.com/maolonglong/microservices-example/pkg/discovery"
+	"github.com/maolonglong/microservices-example/pkg/quota"
+	"github.com/maolonglong/microservices-example/pkg/tracing"
+)
+
+// Config is read from the -config file, then overridden by APIGATEWAY_*
+// environment variables and finally by flags.
+type Config struct {
+	HTTPPort int `yaml:"http_port"`
+
+	Discovery       string `yaml:"discovery"`
+	DiscoveryTarget string `yaml:"discovery_target"`
+
+	Addsvc struct {
+		Transport string   `yaml:"transport"`
+		Tags      []string `yaml:"tags"`
+		Balancer  string   `yaml:"balancer"`
+		Retry     struct {
+			Max     int           `yaml:"max"`
+			Timeout time.Duration `yaml:"timeout"`
+		} `yaml:"retry"`
+		Client addtransport.ClientConfig `yaml:"client"`
+		Cache  addservice.CacheConfig    `yaml:"cache"`
+	} `yaml:"addsvc"`
+
+	Clients quota.Config `yaml:"clients"`
+
+	Trace struct {
+		Exporter string `yaml:"exporter"`
+		File     string `yaml:"file"`
+	} `yaml:"trace"`
+}
+
+func defaultConfig() Config {
+	var c Config
+	c.HTTPPort = 8080
+	c.Discovery = "consul"
+	c.Addsvc.Transport = "grpc"
+	c.Addsvc.Balancer = "round_robin"
+	c.Addsvc.Retry.Max = 3
+	c.Addsvc.Retry.Timeout = 500 * time.Millisecond
+	c.Addsvc.Client = addtransport.DefaultClientConfig()
+	c.Addsvc.Cache = addservice.DefaultCacheConfig()
+	c.Clients = quota.DefaultConfig()
+	c.Trace.Exporter = "none"
+	c.Trace.File = "apigateway-traces.json"
+	return c
+}
+
+func (c *Config) Validate() error {
+	if c.HTTPPort <= 0 {
+		return errors.New("http_port must be positive")
+	}
+	if c.Addsvc.Transport != "grpc" && c.Addsvc.Transport != "http" {
+		return fmt.Errorf("addsvc: unknown transport %q", c.Addsvc.Transport)
+	}
+	if c.Addsvc.Balancer != "round_robin" && c.Addsvc.Balancer != "random" {
+		return fmt.Errorf("addsvc: unknown balancer %q", c.Addsvc.Balancer)
+	}
+	if c.Addsvc.Retry.Max < 1 || c.Addsvc.Retry.Timeout <= 0 {
+		return errors.New("addsvc: retry max must be at least 1 and timeout positive")
+	}
+	if err := c.Addsvc.Client.Validate(); err != nil {
+		return fmt.Errorf("addsvc: client: %w", err)
+	}
+	if err := c.Addsvc.Cache.Validate(); err != nil {
+		return fmt.Errorf("addsvc: cache: %w", err)
+	}
+	if err := c.Clients.Validate(); err != nil {
+		return fmt.Errorf("clients: %w", err)
+	}
+	return nil
+}
+
+// checkReload rejects a new config that changes more than what can be
+// applied without a restart.
+func (c *Config) checkReload(next Config) error {
+	next.Addsvc.Balancer = c.Addsvc.Balancer
+	next.Addsvc.Retry = c.Addsvc.Retry
+	next.Clients = c.Clients
+	if !reflect.DeepEqual(*c, next) {
+		return errors.New("only addsvc.balancer, addsvc.retry and clients can change without a restart")
+	}
+	return nil
+}
+
+// loadConfig builds the Config from the -config file, the environment and
+// the command line flags.
+func loadConfig(errorHandling flag.ErrorHandling) (Config, string, error) {
+	cfg := defaultConfig()
+	fs := flag.NewFlagSet(os.Args[0], errorHandling)
+	path := fs.String("config", os.Getenv("APIGATEWAY_CONFIG"), "YAML or JSON configuration file, watched for changes of the addsvc balancer and retry settings and of the client limits")
+	cfg.flags(fs)
+	err := config.Load(fs, os.Args[1:], path, "APIGATEWAY", &cfg)
+	return cfg, *path, err
+}
+
+func (c *Config) flags(fs *flag.FlagSet) {
+	fs.IntVar(&c.HTTPPort, "http_port", c.HTTPPort, "Address for HTTP (JSON) server")
+
+	fs.StringVar(&c.Discovery, "discovery", c.Discovery, "Service discovery backend: "+strings.Join(discovery.Backends(), ", "))
+	fs.StringVar(&c.DiscoveryTarget, "discovery_target", c.DiscoveryTarget, "Consul agent address, comma separated host:port[#tag...] instances, instance file, DNS SRV domain or registry address, depending on -discovery")
+
+	fs.StringVar(&c.Addsvc.Transport, "addsvc_transport", c.Addsvc.Transport, "Transport used to talk to addsvc: grpc or http")
+	config.ListVar(fs, &c.Addsvc.Tags, "addsvc_tags", "Comma separated tags addsvc instances must carry, in addition to the transport")
+	fs.StringVar(&c.Addsvc.Client.Encoding, "addsvc_encoding", c.Addsvc.Client.Encoding, "Body encoding used with the http transport: "+strings.Join(addtransport.Encodings(), ", "))
+	fs.StringVar(&c.Addsvc.Balancer, "addsvc_balancer", c.Addsvc.Balancer, "Load balancing across addsvc instances: round_robin or random")
+	fs.IntVar(&c.Addsvc.Retry.Max, "addsvc_retry_max", c.Addsvc.Retry.Max, "Maximum number of attempts per addsvc call")
+	fs.DurationVar(&c.Addsvc.Retry.Timeout, "addsvc_retry_timeout", c.Addsvc.Retry.Timeout, "Deadline of an addsvc call, including retries")
+	fs.IntVar(&c.Addsvc.Cache.MaxEntries, "addsvc_cache_max_entries", c.Addsvc.Cache.MaxEntries, "Number of Sum and Concat results kept in memory, 0 to turn caching off")
+	fs.DurationVar(&c.Addsvc.Cache.TTL, "addsvc_cache_ttl", c.Addsvc.Cache.TTL, "Time Sum and Concat results are kept in memory")
+	fs.DurationVar(&c.Addsvc.Cache.Timeout, "addsvc_cache_timeout", c.Addsvc.Cache.Timeout, "Timeout of the calls filling the cache of Sum and Concat results")
+
+	fs.Float64Var(&c.Clients.Default.Rate, "client_rate", c.Clients.Default.Rate, "Requests per second a client may send, unless configured otherwise")
+	fs.IntVar(&c.Clients.Default.Burst, "client_burst", c.Clients.Default.Burst, "Requests a client may send at once, unless configured otherwise")
+	fs.IntVar(&c.Clients.Default.DailyQuota, "client_daily_quota", c.Clients.Default.DailyQuota, "Requests a client may send per UTC day, unless configured otherwise; 0 for no quota")
+	fs.BoolVar(&c.Clients.TrustForwardedFor, "client_trust_forwarded_for", c.Clients.TrustForwardedFor, "Identify clients without API key or token by the last X-Forwarded-For address")
+
+	fs.StringVar(&c.Trace.Exporter, "trace_exporter", c.Trace.Exporter, "Trace exporter: none, "+strings.Join(tracing.Exporters(), ", "))
+	fs.StringVar(&c.Trace.File, "trace_file", c.Trace.File, "Output file of the file trace exporter")
+}
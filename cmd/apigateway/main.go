@@ -2,36 +2,44 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"hash/fnv"
 	"io"
 	"net"
 	"net/http"
 	"os"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/metrics/prometheus"
 	"github.com/go-kit/kit/sd"
-	consulsd "github.com/go-kit/kit/sd/consul"
 	"github.com/go-kit/kit/sd/lb"
 	"github.com/gorilla/mux"
-	"github.com/hashicorp/consul/api"
+	"github.com/maolonglong/microservices-example/pb"
 	"github.com/maolonglong/microservices-example/pkg/addendpoint"
 	"github.com/maolonglong/microservices-example/pkg/addservice"
 	"github.com/maolonglong/microservices-example/pkg/addtransport"
+	"github.com/maolonglong/microservices-example/pkg/config"
+	"github.com/maolonglong/microservices-example/pkg/discovery"
+	"github.com/maolonglong/microservices-example/pkg/quota"
+	"github.com/maolonglong/microservices-example/pkg/tracing"
 	"github.com/oklog/run"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/spf13/cast"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-)
-
-var (
-	httpPort = flag.Int("http_port", 8080, "Address for HTTP (JSON) server")
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 func main() {
-	flag.Parse()
-
 	var logger log.Logger
 	{
 		logger = log.NewLogfmtLogger(os.Stderr)
@@ -39,44 +47,95 @@ func main() {
 		logger = log.With(logger, "caller", log.DefaultCaller)
 	}
 
-	var client consulsd.Client
-	{
-		consulClient, err := api.NewClient(api.DefaultConfig())
-		if err != nil {
-			logger.Log("err", err)
-			os.Exit(1)
-		}
-		client = consulsd.NewClient(consulClient)
+	cfg, configFile, err := loadConfig(flag.ExitOnError)
+	if err != nil {
+		logger.Log("during", "loadConfig", "err", err)
+		os.Exit(1)
 	}
+	var live atomic.Value
+	live.Store(cfg)
+	settings := func() Config { return live.Load().(Config) }
 
-	r := mux.NewRouter()
+	backend, err := discovery.New(cfg.Discovery, cfg.DiscoveryTarget, logger)
+	if err != nil {
+		logger.Log("during", "discovery.New", "err", err)
+		os.Exit(1)
+	}
 
-	var (
-		tags        = []string{}
-		passingOnly = true
-		endpoints   = addendpoint.Set{}
-		instancer   = consulsd.NewInstancer(client, logger, "addsvc", tags, passingOnly)
-	)
+	tracerProvider, err := tracing.NewTracerProvider("apigateway", cfg.Trace.Exporter, cfg.Trace.File)
+	if err != nil {
+		logger.Log("during", "NewTracerProvider", "err", err)
+		os.Exit(1)
+	}
+	defer tracerProvider.Shutdown(context.Background())
+	tracer := tracerProvider.Tracer("apigateway")
+
+	var retries, stateChanges, rejections, cacheLookups, clientRejections metrics.Counter
 	{
-		factory := addsvcFactory(addendpoint.MakeSumEndpoint, logger)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(3, 500*time.Millisecond, balancer)
-		endpoints.SumEndpoint = retry
+		retries = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "apigateway",
+			Subsystem: "addsvc",
+			Name:      "retries_total",
+			Help:      "Total number of retried addsvc calls.",
+		}, []string{"method"})
+		stateChanges = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "apigateway",
+			Subsystem: "addsvc",
+			Name:      "circuit_breaker_state_changes_total",
+			Help:      "Total number of circuit breaker state transitions.",
+		}, []string{"name", "from", "to"})
+		rejections = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "apigateway",
+			Subsystem: "addsvc",
+			Name:      "rate_limited_total",
+			Help:      "Total number of calls rejected by the client-side rate limiter.",
+		}, []string{"method"})
+		cacheLookups = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "apigateway",
+			Subsystem: "addsvc",
+			Name:      "cache_lookups_total",
+			Help:      "Total number of result cache lookups, by result: hit, miss or bypass.",
+		}, []string{"method", "result"})
+		clientRejections = prometheus.NewCounterFrom(stdprometheus.CounterOpts{
+			Namespace: "apigateway",
+			Subsystem: "clients",
+			Name:      "rejected_total",
+			Help:      "Total number of requests rejected by the per-client limits, by reason.",
+		}, []string{"reason"})
 	}
+	var duration metrics.Histogram
 	{
-		factory := addsvcFactory(addendpoint.MakeConcatEndpoint, logger)
-		endpointer := sd.NewEndpointer(instancer, factory, logger)
-		balancer := lb.NewRoundRobin(endpointer)
-		retry := lb.Retry(3, 500*time.Millisecond, balancer)
-		endpoints.ConcatEndpoint = retry
+		duration = prometheus.NewHistogramFrom(stdprometheus.HistogramOpts{
+			Namespace: "apigateway",
+			Subsystem: "addsvc",
+			Name:      "request_duration_seconds",
+			Help:      "Latency of addsvc calls in seconds, including retries.",
+		}, []string{"method", "success"})
 	}
 
-	r.PathPrefix("/addsvc").Handler(http.StripPrefix("/addsvc", addtransport.NewHTTPHandler(endpoints, logger)))
+	r := mux.NewRouter()
+
+	tags := append(append([]string(nil), cfg.Addsvc.Tags...), cfg.Addsvc.Transport)
+	instancer, err := backend.Instancer("addsvc", tags)
+	if err != nil {
+		logger.Log("during", "Instancer", "err", err)
+		os.Exit(1)
+	}
+	defer instancer.Stop()
+
+	limiter := quota.NewLimiter(cfg.Clients, clientRejections)
+	handler, openAPI := newAddsvcHandler(cfg, settings, instancer, limiter, logger, tracer, retries, stateChanges, rejections, cacheLookups, duration)
+
+	r.Methods(http.MethodGet).Path("/metrics").Handler(promhttp.Handler())
+	// The admin routes answer 404 until clients.admin_token is set.
+	r.Methods(http.MethodGet).Path("/admin/clients").Handler(limiter.AdminHandler())
+	r.Methods(http.MethodGet).Path("/admin/clients/{client}").Handler(limiter.AdminHandler())
+	r.Methods(http.MethodGet).Path("/addsvc/openapi.json").Handler(openAPI)
+	r.PathPrefix("/addsvc").Handler(http.StripPrefix("/addsvc", limiter.Handler(handler)))
 
 	var g run.Group
 	{
-		httpAddr := ":" + cast.ToString(*httpPort)
+		httpAddr := ":" + cast.ToString(cfg.HTTPPort)
 		httpListener, err := net.Listen("tcp", httpAddr)
 		if err != nil {
 			logger.Log("transport", "HTTP", "during", "Listen", "err", err)
@@ -89,18 +148,228 @@ func main() {
 			httpListener.Close()
 		})
 	}
+	{
+		// Only the balancer, retry and client settings can change at runtime.
+		// A config that fails to load or touches anything else is rejected as
+		// a whole, and the one in use stays in effect.
+		reload := func() {
+			current := settings()
+			next, _, err := loadConfig(flag.ContinueOnError)
+			if err == nil {
+				err = current.checkReload(next)
+			}
+			if err != nil {
+				logger.Log("during", "reload", "err", err)
+				return
+			}
+			live.Store(next)
+			limiter.Update(next.Clients)
+			logger.Log("during", "reload", "config", configFile)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		g.Add(func() error {
+			return config.Watch(ctx, configFile, reload)
+		}, func(error) {
+			cancel()
+		})
+	}
 	g.Add(run.SignalHandler(context.Background(), syscall.SIGINT, syscall.SIGTERM))
 	logger.Log("exit", g.Run())
 }
 
-func addsvcFactory(makeEndpoint func(addservice.Service) endpoint.Endpoint, logger log.Logger) sd.Factory {
+// newAddsvcHandler returns the handler of the addsvc routes and the one of
+// their OpenAPI document, both calling the instances found by instancer.
+// limiter charges the items of batches and streams; the handler is to be
+// served behind its Handler.
+func newAddsvcHandler(cfg Config, settings func() Config, instancer sd.Instancer, limiter *quota.Limiter, logger log.Logger, tracer trace.Tracer, retries, stateChanges, rejections, cacheLookups metrics.Counter, duration metrics.Histogram) (handler, openAPI http.Handler) {
+	// Over gRPC every annotated method of the AddService descriptor is
+	// transcoded, so new RPCs need no code here. Streams are not retried, as
+	// their requests are consumed on the way. The HTTP transport has no
+	// descriptors to go by and keeps one hand-made endpoint per method of
+	// addservice.Service; batches and streams answer 501 there. Either way
+	// the methods of addservice.Service go through the cache before being
+	// retried. The per-client limits charge batches, found by their repeated
+	// message field, and streams by item.
+	cache := addservice.NewCache(cfg.Addsvc.Cache, cacheLookups)
+	if cfg.Addsvc.Transport == "grpc" {
+		service := pb.File_user_proto.Services().ByName("AddService")
+		endpoints := map[protoreflect.FullName]endpoint.Endpoint{}
+		methods := service.Methods()
+		for i := 0; i < methods.Len(); i++ {
+			method := methods.Get(i)
+			name := string(method.Name())
+			factory := grpcMethodFactory(method, cfg.Addsvc.Client, stateChanges, rejections, tracer)
+			endpointer := sd.NewEndpointer(instancer, factory, logger)
+			var e endpoint.Endpoint
+			if method.IsStreamingClient() || method.IsStreamingServer() {
+				e = balanced(endpointer, settings)
+			} else {
+				e = unwrapRetryError(balancedRetry(endpointer, settings, retries.With("method", name)))
+			}
+			e = addendpoint.InstrumentingMiddleware(duration.With("method", name))(e)
+			if method.IsStreamingClient() {
+				e = limiter.StreamMiddleware()(e)
+			} else if items, ok := batchItems(method); ok {
+				e = limiter.BatchMiddleware(items)(e)
+			}
+			endpoints[method.FullName()] = e
+		}
+		cached := addservice.CachingMiddleware(cache)(addtransport.NewMethodService(endpoints))
+		for name, e := range addtransport.NewServiceMethodEndpoints(cached) {
+			endpoints[name] = e
+		}
+		handler = addtransport.NewTranscodingHandler(service, endpoints, logger, tracer)
+		openAPI = http.HandlerFunc(addtransport.ServeOpenAPI)
+	} else {
+		endpoints := addendpoint.Set{}
+		{
+			factory := httpFactory(addendpoint.MakeSumEndpoint, "Sum", cfg.Addsvc.Client, logger, stateChanges, rejections, tracer)
+			endpointer := sd.NewEndpointer(instancer, factory, logger)
+			retry := balancedRetry(endpointer, settings, retries.With("method", "Sum"))
+			endpoints.SumEndpoint = addendpoint.InstrumentingMiddleware(duration.With("method", "Sum"))(unwrapRetryError(retry))
+		}
+		{
+			factory := httpFactory(addendpoint.MakeConcatEndpoint, "Concat", cfg.Addsvc.Client, logger, stateChanges, rejections, tracer)
+			endpointer := sd.NewEndpointer(instancer, factory, logger)
+			retry := balancedRetry(endpointer, settings, retries.With("method", "Concat"))
+			endpoints.ConcatEndpoint = addendpoint.InstrumentingMiddleware(duration.With("method", "Concat"))(unwrapRetryError(retry))
+		}
+		{
+			factory := httpFactory(addendpoint.MakeSumDecimalEndpoint, "SumDecimal", cfg.Addsvc.Client, logger, stateChanges, rejections, tracer)
+			endpointer := sd.NewEndpointer(instancer, factory, logger)
+			retry := balancedRetry(endpointer, settings, retries.With("method", "SumDecimal"))
+			endpoints.SumDecimalEndpoint = addendpoint.InstrumentingMiddleware(duration.With("method", "SumDecimal"))(unwrapRetryError(retry))
+		}
+		{
+			factory := httpFactory(addendpoint.MakeEvalEndpoint, "Eval", cfg.Addsvc.Client, logger, stateChanges, rejections, tracer)
+			endpointer := sd.NewEndpointer(instancer, factory, logger)
+			retry := balancedRetry(endpointer, settings, retries.With("method", "Eval"))
+			endpoints.EvalEndpoint = addendpoint.InstrumentingMiddleware(duration.With("method", "Eval"))(unwrapRetryError(retry))
+		}
+		cached := addservice.CachingMiddleware(cache)(endpoints)
+		endpoints.SumEndpoint = addendpoint.MakeSumEndpoint(cached)
+		endpoints.ConcatEndpoint = addendpoint.MakeConcatEndpoint(cached)
+		handler = addtransport.NewHTTPHandler(endpoints, logger, tracer)
+		openAPI = addtransport.OpenAPIHandler(endpoints)
+	}
+	return handler, openAPI
+}
+
+// batchItems returns a function counting the items of the requests of
+// method, the elements of the first repeated message field of its input,
+// if it has one.
+func batchItems(method protoreflect.MethodDescriptor) (func(request interface{}) int, bool) {
+	fields := method.Input().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		if f := fields.Get(i); f.IsList() && f.Message() != nil {
+			return func(request interface{}) int {
+				return request.(proto.Message).ProtoReflect().Get(f).List().Len()
+			}, true
+		}
+	}
+	return nil, false
+}
+
+func grpcMethodFactory(method protoreflect.MethodDescriptor, cfg addtransport.ClientConfig, stateChanges, rejections metrics.Counter, tracer trace.Tracer) sd.Factory {
 	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
 		conn, err := grpc.Dial(instance, grpc.WithInsecure())
 		if err != nil {
 			return nil, nil, err
 		}
-		service := addtransport.NewGRPCClient(conn, logger)
-		endpoint := makeEndpoint(service)
+		endpoint := addtransport.NewGRPCMethodClient(conn, method, cfg, stateChanges, rejections)
+		endpoint = addendpoint.TracingMiddleware(tracer, string(method.Name())+" attempt", attribute.String("peer.address", instance))(endpoint)
 		return endpoint, conn, nil
 	}
 }
+
+func httpFactory(makeEndpoint func(addservice.Service) endpoint.Endpoint, method string, cfg addtransport.ClientConfig, logger log.Logger, stateChanges, rejections metrics.Counter, tracer trace.Tracer) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		service, err := addtransport.NewHTTPClient(instance, cfg, logger, stateChanges, rejections)
+		if err != nil {
+			return nil, nil, err
+		}
+		endpoint := makeEndpoint(service)
+		endpoint = addendpoint.FailureMiddleware()(endpoint)
+		endpoint = addendpoint.TracingMiddleware(tracer, method+" attempt", attribute.String("peer.address", instance))(endpoint)
+		return endpoint, nil, nil
+	}
+}
+
+// balancedRetry balances calls over the instances of endpointer and retries
+// them, with the balancer and retry settings current at the time of the call.
+// Calls with an idempotency key go to the instance the key hashes to, and so
+// do their retries, as every instance has its own IdempotencyStore.
+func balancedRetry(endpointer sd.Endpointer, settings func() Config, retries metrics.Counter) endpoint.Endpoint {
+	balancers := map[string]lb.Balancer{
+		"round_robin": lb.NewRoundRobin(endpointer),
+		"random":      lb.NewRandom(endpointer, time.Now().UnixNano()),
+	}
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		cfg := settings().Addsvc
+		balancer := balancers[cfg.Balancer]
+		if key := addservice.IdempotencyKey(ctx); key != "" {
+			balancer = keyedBalancer{endpointer, key}
+		}
+		retry := lb.RetryWithCallback(cfg.Retry.Timeout, balancer, retryCallback(cfg.Retry.Max, retries))
+		return retry(ctx, request)
+	}
+}
+
+// keyedBalancer always picks the same instance for the same key, as long as
+// the instances of endpointer stay the same; they come sorted by address.
+type keyedBalancer struct {
+	endpointer sd.Endpointer
+	key        string
+}
+
+func (b keyedBalancer) Endpoint() (endpoint.Endpoint, error) {
+	endpoints, err := b.endpointer.Endpoints()
+	if err != nil {
+		return nil, err
+	}
+	if len(endpoints) == 0 {
+		return nil, lb.ErrNoEndpoints
+	}
+	h := fnv.New32a()
+	io.WriteString(h, b.key)
+	return endpoints[h.Sum32()%uint32(len(endpoints))], nil
+}
+
+// balanced is balancedRetry with a single attempt and no timeout.
+func balanced(endpointer sd.Endpointer, settings func() Config) endpoint.Endpoint {
+	balancers := map[string]lb.Balancer{
+		"round_robin": lb.NewRoundRobin(endpointer),
+		"random":      lb.NewRandom(endpointer, time.Now().UnixNano()),
+	}
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		e, err := balancers[settings().Addsvc.Balancer].Endpoint()
+		if err != nil {
+			return nil, err
+		}
+		return e(ctx, request)
+	}
+}
+
+// unwrapRetryError hands the last error of a failed retry sequence to the
+// transport, so that it can still be matched against registered errors.
+func unwrapRetryError(next endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		response, err := next(ctx, request)
+		var retryErr lb.RetryError
+		if errors.As(err, &retryErr) && retryErr.Final != nil {
+			err = retryErr.Final
+		}
+		return response, err
+	}
+}
+
+// retryCallback behaves like lb.Retry's max attempts, but counts every retry.
+func retryCallback(max int, retries metrics.Counter) lb.Callback {
+	return func(n int, _ error) (bool, error) {
+		keepTrying := n < max
+		if keepTrying {
+			retries.Add(1)
+		}
+		return keepTrying, nil
+	}
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/sd"
+	kitgrpc "github.com/go-kit/kit/transport/grpc"
+	"github.com/maolonglong/microservices-example/pb"
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"github.com/maolonglong/microservices-example/pkg/addtransport"
+	"github.com/maolonglong/microservices-example/pkg/discovery"
+	"github.com/maolonglong/microservices-example/pkg/quota"
+	"github.com/maolonglong/microservices-example/pkg/registry"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// TestGateway calls an addsvc instance through the gateway, which finds it
+// in the registry under the tag of its transport.
+func TestGateway(t *testing.T) {
+	for _, transport := range []string{"grpc", "http"} {
+		t.Run(transport, func(t *testing.T) {
+			handler, openAPI := newGateway(t, transport, nil, nil)
+
+			for _, tc := range []struct {
+				path   string
+				body   string
+				status int
+				want   string
+			}{
+				{"/v1/sum", `{"a":1,"b":2}`, http.StatusOK, `{"v":3}`},
+				{"/v1/concat", `{"a":"1","b":"2"}`, http.StatusOK, `{"v":"12"}`},
+				{"/v1/sum", `{"a":0,"b":0}`, http.StatusBadRequest, "TWO_ZEROES"},
+			} {
+				status, body := post(handler, tc.path, tc.body)
+				if status != tc.status || !strings.Contains(body, tc.want) {
+					t.Fatalf("%s %s: want %d %s, have %d %s", tc.path, tc.body, tc.status, tc.want, status, body)
+				}
+			}
+
+			// Over HTTP the gateway has no endpoint for batches.
+			wantBatch := http.StatusOK
+			if transport == "http" {
+				wantBatch = http.StatusNotImplemented
+			}
+			if status, body := post(handler, "/v1/sum:batch", `{"items":[{"a":1,"b":2}]}`); status != wantBatch {
+				t.Fatalf("/v1/sum:batch: want %d, have %d %s", wantBatch, status, body)
+			}
+			if transport == "grpc" {
+				const (
+					ops  = `{"operations":[{"sum":{"a":1,"b":2}},{"concat":{"a":"1","b":"2"}},{"sum_decimal":{"a":"40","b":"2"}},{"eval":{"expr":"x + 1","vars":{"x":{"int":2}}}}]}`
+					want = `{"results":[{"sum":{"v":3}},{"concat":{"v":"12"}},{"sumDecimal":{"v":"42"}},{"eval":{"v":{"int":3}}}]}`
+				)
+				if status, body := post(handler, "/v1/batch", ops); status != http.StatusOK || strings.TrimSpace(body) != want {
+					t.Fatalf("/v1/batch: want %d %s, have %d %s", http.StatusOK, want, status, body)
+				}
+			}
+			w := httptest.NewRecorder()
+			openAPI.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/addsvc/openapi.json", nil))
+			var doc struct{ Paths map[string]interface{} }
+			if err := json.NewDecoder(w.Body).Decode(&doc); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := doc.Paths["/v1/sum:batch"]; ok != (wantBatch == http.StatusOK) {
+				t.Fatalf("/v1/sum:batch listed in the OpenAPI document: %v", ok)
+			}
+		})
+	}
+}
+
+// TestGatewayForwardsContext checks that the idempotency key and the trace
+// of a request reach addsvc, whether or not the method goes through the
+// cache of the gateway.
+func TestGatewayForwardsContext(t *testing.T) {
+	const traceID = "0af7651916cd43dd8448eb211c80319c"
+	for _, transport := range []string{"grpc", "http"} {
+		t.Run(transport, func(t *testing.T) {
+			var (
+				mtx      sync.Mutex
+				keys     []string
+				traceIDs []string
+			)
+			observe := func(next endpoint.Endpoint) endpoint.Endpoint {
+				return func(ctx context.Context, request interface{}) (interface{}, error) {
+					mtx.Lock()
+					keys = append(keys, addservice.IdempotencyKey(ctx))
+					traceIDs = append(traceIDs, trace.SpanContextFromContext(ctx).TraceID().String())
+					mtx.Unlock()
+					return next(ctx, request)
+				}
+			}
+			handler, _ := newGateway(t, transport, observe, nil)
+
+			for _, tc := range []struct {
+				path string
+				body string
+				key  string
+			}{
+				{"/v1/sum", `{"a":2,"b":3}`, "k1"},
+				{"/v1/sum", `{"a":2,"b":4}`, ""},
+				{"/v1/concat", `{"a":"2","b":"3"}`, "k2"},
+				{"/v1/concat", `{"a":"2","b":"4"}`, ""},
+				{"/v1/sum:decimal", `{"a":"2","b":"3"}`, "k3"},
+			} {
+				mtx.Lock()
+				keys, traceIDs = nil, nil
+				mtx.Unlock()
+				r := httptest.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+				r.Header.Set("Content-Type", "application/json")
+				if tc.key != "" {
+					r.Header.Set("Idempotency-Key", tc.key)
+				}
+				r.Header.Set("Traceparent", "00-"+traceID+"-b7ad6b7169203331-01")
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+				if w.Code != http.StatusOK {
+					t.Fatalf("%s: want status 200, have %d %s", tc.path, w.Code, w.Body)
+				}
+				mtx.Lock()
+				if len(keys) != 1 || keys[0] != tc.key || traceIDs[0] != traceID {
+					t.Fatalf("%s %s: addsvc saw keys %q and traces %q", tc.path, tc.body, keys, traceIDs)
+				}
+				mtx.Unlock()
+			}
+		})
+	}
+}
+
+// TestGatewayChargesItems checks that the per-client limits count the
+// items of batches and streams, not only the requests.
+func TestGatewayChargesItems(t *testing.T) {
+	items := func(n int) string {
+		return strings.TrimSuffix(strings.Repeat(`{"a":1,"b":2},`, n), ",")
+	}
+	for _, tc := range []struct {
+		name   string
+		limit  quota.Limit
+		path   string
+		body   string
+		status []int // of the same request sent again and again
+		want   string
+	}{
+		{"batch", quota.Limit{Rate: 0.001, Burst: 5}, "/v1/sum:batch", `{"items":[` + items(3) + `]}`,
+			[]int{http.StatusOK, http.StatusTooManyRequests}, "RATE_LIMITED"},
+		{"batch beyond the burst", quota.Limit{Rate: 0.001, Burst: 5}, "/v1/sum:batch", `{"items":[` + items(6) + `]}`,
+			[]int{http.StatusRequestEntityTooLarge}, "BATCH_TOO_LARGE"},
+		{"batch quota", quota.Limit{Rate: 100, Burst: 100, DailyQuota: 5}, "/v1/sum:batch", `{"items":[` + items(3) + `]}`,
+			[]int{http.StatusOK, http.StatusTooManyRequests}, "QUOTA_EXCEEDED"},
+		{"generic batch", quota.Limit{Rate: 0.001, Burst: 5}, "/v1/batch", `{"operations":[{"sum":{"a":1,"b":2}},{"sum":{"a":1,"b":2}},{"sum":{"a":1,"b":2}}]}`,
+			[]int{http.StatusOK, http.StatusTooManyRequests}, "RATE_LIMITED"},
+		{"stream quota", quota.Limit{Rate: 100, Burst: 100, DailyQuota: 3}, "/v1/sum:stream", strings.ReplaceAll(items(5), "},{", "}\n{"),
+			[]int{http.StatusOK}, strings.Repeat(`{"result":{"v":3}}`+"\n", 3) + `{"error":"daily quota exceeded","reason":"QUOTA_EXCEEDED"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := quota.DefaultConfig()
+			cfg.Default = tc.limit
+			limiter := quota.NewLimiter(cfg, discard.NewCounter())
+			handler, _ := newGateway(t, "grpc", nil, limiter)
+			handler = limiter.Handler(handler)
+
+			var body string
+			for i, want := range tc.status {
+				var status int
+				status, body = post(handler, tc.path, tc.body)
+				if status != want {
+					t.Fatalf("request %d: want status %d, have %d %s", i, want, status, body)
+				}
+			}
+			if !strings.Contains(body, tc.want) {
+				t.Fatalf("want %s, have %s", tc.want, body)
+			}
+		})
+	}
+}
+
+// newGateway returns the addsvc handler and OpenAPI handler of a gateway
+// that finds, in an in-process registry, a single addsvc instance serving
+// transport, once that instance is reachable. If observe is not nil, it
+// wraps the endpoints of the instance. limiter, if not nil, charges the
+// items of batches and streams; the handlers are not behind it.
+func newGateway(t *testing.T, transport string, observe endpoint.Middleware, limiter *quota.Limiter) (handler, openAPI http.Handler) {
+	t.Helper()
+	logger := log.NewNopLogger()
+	reg := registry.New(time.Second, time.Second, logger)
+	t.Cleanup(reg.Stop)
+	registryServer := httptest.NewServer(registry.NewHTTPHandler(reg, logger))
+	t.Cleanup(registryServer.Close)
+	backend, err := discovery.New("registry", registryServer.URL, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addr := serveAddsvc(t, transport, logger, observe)
+	host, port, _ := net.SplitHostPort(addr)
+	portNum, _ := strconv.Atoi(port)
+	registrar, err := backend.Registrar(discovery.Registration{
+		ID:      "addsvc-" + transport,
+		Name:    "addsvc",
+		Address: host,
+		Port:    portNum,
+		Tags:    []string{transport},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	registrar.Register()
+	t.Cleanup(registrar.Deregister)
+
+	cfg := defaultConfig()
+	cfg.Addsvc.Transport = transport
+	instancer, err := backend.Instancer("addsvc", []string{transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(instancer.Stop)
+	settings := func() Config { return cfg }
+	if limiter == nil {
+		limiter = quota.NewLimiter(cfg.Clients, discard.NewCounter())
+	}
+	handler, openAPI = newAddsvcHandler(cfg, settings, instancer, limiter, logger, trace.NewNoopTracerProvider().Tracer(""),
+		discard.NewCounter(), discard.NewCounter(), discard.NewCounter(), discard.NewCounter(), discard.NewHistogram())
+
+	// The instance shows up once the watch of the registry returns.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if status, _ := post(handler, "/v1/sum:decimal", `{"a":"1","b":"2"}`); status == http.StatusOK {
+			return handler, openAPI
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("addsvc never became reachable through the registry")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// serveAddsvc serves addsvc over transport on a local port and returns its
+// address.
+func serveAddsvc(t *testing.T, transport string, logger log.Logger, observe endpoint.Middleware) string {
+	t.Helper()
+	tracer := trace.NewNoopTracerProvider().Tracer("")
+	limits := addendpoint.DefaultConfig()
+	limits.Sum = addendpoint.RateLimit{Rate: 100, Burst: 100}
+	svc := addservice.New(addservice.NewLimits(addservice.DefaultConfig()), addservice.NewCache(addservice.DefaultCacheConfig(), discard.NewCounter()), logger, discard.NewCounter(), discard.NewCounter(), discard.NewHistogram(), tracer)
+	endpoints := addendpoint.New(svc, logger, discard.NewHistogram(), discard.NewCounter(), tracer, addendpoint.NewLimiters(limits), addendpoint.NewIdempotencyStore(limits.Idempotency))
+	if observe != nil {
+		endpoints.SumEndpoint = observe(endpoints.SumEndpoint)
+		endpoints.ConcatEndpoint = observe(endpoints.ConcatEndpoint)
+		endpoints.SumDecimalEndpoint = observe(endpoints.SumDecimalEndpoint)
+	}
+
+	if transport == "http" {
+		server := httptest.NewServer(addtransport.NewHTTPHandler(endpoints, logger, tracer))
+		t.Cleanup(server.Close)
+		return server.Listener.Addr().String()
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer(grpc.UnaryInterceptor(kitgrpc.Interceptor))
+	pb.RegisterAddServiceServer(server, addtransport.NewGRPCServer(endpoints, logger))
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener.Addr().String()
+}
+
+func post(h http.Handler, path, body string) (int, string) {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w.Code, w.Body.String()
+}
+
+func TestBalancedRetryKeepsKeyedCallsOnOneInstance(t *testing.T) {
+	var (
+		mtx  sync.Mutex
+		hits = map[int]int{}
+	)
+	var endpointer sd.FixedEndpointer
+	for i := 0; i < 3; i++ {
+		i := i
+		endpointer = append(endpointer, func(context.Context, interface{}) (interface{}, error) {
+			mtx.Lock()
+			hits[i]++
+			mtx.Unlock()
+			return nil, errors.New("unavailable")
+		})
+	}
+	cfg := defaultConfig()
+	cfg.Addsvc.Retry.Max = 6
+	e := balancedRetry(endpointer, func() Config { return cfg }, discard.NewCounter())
+
+	e(context.Background(), nil)
+	if len(hits) != 3 {
+		t.Fatalf("want the attempts of a call without key spread over 3 instances, have %v", hits)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		hits = map[int]int{}
+		e(addservice.WithIdempotencyKey(context.Background(), key), nil)
+		e(addservice.WithIdempotencyKey(context.Background(), key), nil)
+		if len(hits) != 1 {
+			t.Fatalf("key %q: want every attempt on one instance, have %v", key, hits)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/maolonglong/microservices-example/pkg/registry"
+	"github.com/oklog/run"
+	"github.com/spf13/cast"
+)
+
+var (
+	httpPort      = flag.Int("http_port", 8400, "HTTP listen address")
+	checkInterval = flag.Duration("check_interval", 5*time.Second, "Interval between health checks of registered instances")
+	checkTimeout  = flag.Duration("check_timeout", 2*time.Second, "Timeout of a single health check")
+)
+
+func main() {
+	flag.Parse()
+
+	var logger log.Logger
+	{
+		logger = log.NewLogfmtLogger(os.Stderr)
+		logger = log.With(logger, "ts", log.DefaultTimestampUTC)
+		logger = log.With(logger, "caller", log.DefaultCaller)
+	}
+
+	reg := registry.New(*checkInterval, *checkTimeout, logger)
+	defer reg.Stop()
+
+	var g run.Group
+	{
+		httpAddr := ":" + cast.ToString(*httpPort)
+		httpListener, err := net.Listen("tcp", httpAddr)
+		if err != nil {
+			logger.Log("transport", "HTTP", "during", "Listen", "err", err)
+			os.Exit(1)
+		}
+		g.Add(func() error {
+			logger.Log("transport", "HTTP", "addr", httpAddr)
+			return http.Serve(httpListener, registry.NewHTTPHandler(reg, logger))
+		}, func(error) {
+			httpListener.Close()
+		})
+	}
+	g.Add(run.SignalHandler(context.Background(), syscall.SIGINT, syscall.SIGTERM))
+	logger.Log("exit", g.Run())
+}
@@ -20,6 +20,23 @@ const _ = grpc.SupportPackageIsVersion7
 type AddServiceClient interface {
 	Sum(ctx context.Context, in *SumRequest, opts ...grpc.CallOption) (*SumResponse, error)
 	Concat(ctx context.Context, in *ConcatRequest, opts ...grpc.CallOption) (*ConcatResponse, error)
+	// SumDecimal adds integers written in decimal, so that clients can pass
+	// numbers beyond the precision of their own number types, like those of
+	// JavaScript.
+	SumDecimal(ctx context.Context, in *SumDecimalRequest, opts ...grpc.CallOption) (*SumDecimalResponse, error)
+	// BatchSum adds every pair of the request in one call. Failures are
+	// reported per item; only a batch that is rejected as a whole fails.
+	BatchSum(ctx context.Context, in *BatchSumRequest, opts ...grpc.CallOption) (*BatchSumResponse, error)
+	// SumStream answers every request with one result, in order. Failures are
+	// reported per item; the stream itself only fails on transport errors,
+	// cancellation or rejection.
+	SumStream(ctx context.Context, opts ...grpc.CallOption) (AddService_SumStreamClient, error)
+	// Batch runs operations of any method, each under the rate limit of its
+	// method. Failures are reported per operation.
+	Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	// Eval evaluates an expression over integers and strings in one call,
+	// instead of one call per Sum or Concat.
+	Eval(ctx context.Context, in *EvalRequest, opts ...grpc.CallOption) (*EvalResponse, error)
 }
 
 type addServiceClient struct {
@@ -48,12 +65,96 @@ func (c *addServiceClient) Concat(ctx context.Context, in *ConcatRequest, opts .
 	return out, nil
 }
 
+func (c *addServiceClient) SumDecimal(ctx context.Context, in *SumDecimalRequest, opts ...grpc.CallOption) (*SumDecimalResponse, error) {
+	out := new(SumDecimalResponse)
+	err := c.cc.Invoke(ctx, "/pb.AddService/SumDecimal", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *addServiceClient) BatchSum(ctx context.Context, in *BatchSumRequest, opts ...grpc.CallOption) (*BatchSumResponse, error) {
+	out := new(BatchSumResponse)
+	err := c.cc.Invoke(ctx, "/pb.AddService/BatchSum", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *addServiceClient) SumStream(ctx context.Context, opts ...grpc.CallOption) (AddService_SumStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AddService_ServiceDesc.Streams[0], "/pb.AddService/SumStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &addServiceSumStreamClient{stream}
+	return x, nil
+}
+
+type AddService_SumStreamClient interface {
+	Send(*SumRequest) error
+	Recv() (*SumResult, error)
+	grpc.ClientStream
+}
+
+type addServiceSumStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *addServiceSumStreamClient) Send(m *SumRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *addServiceSumStreamClient) Recv() (*SumResult, error) {
+	m := new(SumResult)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *addServiceClient) Batch(ctx context.Context, in *BatchRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, "/pb.AddService/Batch", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *addServiceClient) Eval(ctx context.Context, in *EvalRequest, opts ...grpc.CallOption) (*EvalResponse, error) {
+	out := new(EvalResponse)
+	err := c.cc.Invoke(ctx, "/pb.AddService/Eval", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // AddServiceServer is the server API for AddService service.
 // All implementations should embed UnimplementedAddServiceServer
 // for forward compatibility
 type AddServiceServer interface {
 	Sum(context.Context, *SumRequest) (*SumResponse, error)
 	Concat(context.Context, *ConcatRequest) (*ConcatResponse, error)
+	// SumDecimal adds integers written in decimal, so that clients can pass
+	// numbers beyond the precision of their own number types, like those of
+	// JavaScript.
+	SumDecimal(context.Context, *SumDecimalRequest) (*SumDecimalResponse, error)
+	// BatchSum adds every pair of the request in one call. Failures are
+	// reported per item; only a batch that is rejected as a whole fails.
+	BatchSum(context.Context, *BatchSumRequest) (*BatchSumResponse, error)
+	// SumStream answers every request with one result, in order. Failures are
+	// reported per item; the stream itself only fails on transport errors,
+	// cancellation or rejection.
+	SumStream(AddService_SumStreamServer) error
+	// Batch runs operations of any method, each under the rate limit of its
+	// method. Failures are reported per operation.
+	Batch(context.Context, *BatchRequest) (*BatchResponse, error)
+	// Eval evaluates an expression over integers and strings in one call,
+	// instead of one call per Sum or Concat.
+	Eval(context.Context, *EvalRequest) (*EvalResponse, error)
 }
 
 // UnimplementedAddServiceServer should be embedded to have forward compatible implementations.
@@ -66,6 +167,21 @@ func (UnimplementedAddServiceServer) Sum(context.Context, *SumRequest) (*SumResp
 func (UnimplementedAddServiceServer) Concat(context.Context, *ConcatRequest) (*ConcatResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Concat not implemented")
 }
+func (UnimplementedAddServiceServer) SumDecimal(context.Context, *SumDecimalRequest) (*SumDecimalResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SumDecimal not implemented")
+}
+func (UnimplementedAddServiceServer) BatchSum(context.Context, *BatchSumRequest) (*BatchSumResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchSum not implemented")
+}
+func (UnimplementedAddServiceServer) SumStream(AddService_SumStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method SumStream not implemented")
+}
+func (UnimplementedAddServiceServer) Batch(context.Context, *BatchRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Batch not implemented")
+}
+func (UnimplementedAddServiceServer) Eval(context.Context, *EvalRequest) (*EvalResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Eval not implemented")
+}
 
 // UnsafeAddServiceServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to AddServiceServer will
@@ -114,6 +230,104 @@ func _AddService_Concat_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _AddService_SumDecimal_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SumDecimalRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AddServiceServer).SumDecimal(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.AddService/SumDecimal",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AddServiceServer).SumDecimal(ctx, req.(*SumDecimalRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AddService_BatchSum_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchSumRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AddServiceServer).BatchSum(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.AddService/BatchSum",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AddServiceServer).BatchSum(ctx, req.(*BatchSumRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AddService_SumStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(AddServiceServer).SumStream(&addServiceSumStreamServer{stream})
+}
+
+type AddService_SumStreamServer interface {
+	Send(*SumResult) error
+	Recv() (*SumRequest, error)
+	grpc.ServerStream
+}
+
+type addServiceSumStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *addServiceSumStreamServer) Send(m *SumResult) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *addServiceSumStreamServer) Recv() (*SumRequest, error) {
+	m := new(SumRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _AddService_Batch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AddServiceServer).Batch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.AddService/Batch",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AddServiceServer).Batch(ctx, req.(*BatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AddService_Eval_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EvalRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AddServiceServer).Eval(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.AddService/Eval",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AddServiceServer).Eval(ctx, req.(*EvalRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // AddService_ServiceDesc is the grpc.ServiceDesc for AddService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -129,7 +343,30 @@ var AddService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Concat",
 			Handler:    _AddService_Concat_Handler,
 		},
+		{
+			MethodName: "SumDecimal",
+			Handler:    _AddService_SumDecimal_Handler,
+		},
+		{
+			MethodName: "BatchSum",
+			Handler:    _AddService_BatchSum_Handler,
+		},
+		{
+			MethodName: "Batch",
+			Handler:    _AddService_Batch_Handler,
+		},
+		{
+			MethodName: "Eval",
+			Handler:    _AddService_Eval_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "SumStream",
+			Handler:       _AddService_SumStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "user.proto",
 }
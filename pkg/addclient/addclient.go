@@ -0,0 +1,131 @@
+package addclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/lb"
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"github.com/maolonglong/microservices-example/pkg/addtransport"
+	"github.com/maolonglong/microservices-example/pkg/discovery"
+	"google.golang.org/grpc"
+)
+
+// Config tells New how to reach addsvc: directly over gRPC or HTTP, the
+// latter also covering the gateway, or through service discovery.
+type Config struct {
+	GRPCAddr string
+	HTTPAddr string
+
+	Discovery       string
+	DiscoveryTarget string
+	Transport       string
+	Tags            []string
+
+	Client addtransport.ClientConfig
+}
+
+// discoveryWait bounds how long New waits for the first instances.
+const discoveryWait = 5 * time.Second
+
+// New returns a client for the addsvc given by cfg, and a function that
+// releases its resources.
+func New(cfg Config, logger log.Logger) (addservice.Service, func(), error) {
+	switch {
+	case cfg.GRPCAddr != "":
+		conn, err := grpc.Dial(cfg.GRPCAddr, grpc.WithInsecure())
+		if err != nil {
+			return nil, nil, err
+		}
+		svc := addtransport.NewGRPCClient(conn, cfg.Client, logger, discard.NewCounter(), discard.NewCounter())
+		return svc, func() { conn.Close() }, nil
+	case cfg.HTTPAddr != "":
+		svc, err := addtransport.NewHTTPClient(cfg.HTTPAddr, cfg.Client, logger, discard.NewCounter(), discard.NewCounter())
+		return svc, func() {}, err
+	case cfg.Discovery != "":
+		return newDiscoveryClient(cfg, logger)
+	default:
+		return nil, nil, errors.New("no gRPC address, HTTP address or discovery backend given")
+	}
+}
+
+func newDiscoveryClient(cfg Config, logger log.Logger) (addservice.Service, func(), error) {
+	if cfg.Transport != "grpc" && cfg.Transport != "http" {
+		return nil, nil, errors.New("transport must be grpc or http")
+	}
+	backend, err := discovery.New(cfg.Discovery, cfg.DiscoveryTarget, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	instancer, err := backend.Instancer("addsvc", append(append([]string(nil), cfg.Tags...), cfg.Transport))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		sumEndpointer        = sd.NewEndpointer(instancer, factory(addendpoint.MakeSumEndpoint, cfg, logger), logger)
+		concatEndpointer     = sd.NewEndpointer(instancer, factory(addendpoint.MakeConcatEndpoint, cfg, logger), logger)
+		sumDecimalEndpointer = sd.NewEndpointer(instancer, factory(addendpoint.MakeSumDecimalEndpoint, cfg, logger), logger)
+		evalEndpointer       = sd.NewEndpointer(instancer, factory(addendpoint.MakeEvalEndpoint, cfg, logger), logger)
+		release              = func() {
+			sumEndpointer.Close()
+			concatEndpointer.Close()
+			sumDecimalEndpointer.Close()
+			evalEndpointer.Close()
+			instancer.Stop()
+		}
+	)
+	for deadline := time.Now().Add(discoveryWait); ; time.Sleep(100 * time.Millisecond) {
+		if endpoints, _ := sumEndpointer.Endpoints(); len(endpoints) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			release()
+			return nil, nil, lb.ErrNoEndpoints
+		}
+	}
+
+	return addendpoint.Set{
+		SumEndpoint:        balanced(lb.NewRoundRobin(sumEndpointer)),
+		ConcatEndpoint:     balanced(lb.NewRoundRobin(concatEndpointer)),
+		SumDecimalEndpoint: balanced(lb.NewRoundRobin(sumDecimalEndpointer)),
+		EvalEndpoint:       balanced(lb.NewRoundRobin(evalEndpointer)),
+	}, release, nil
+}
+
+func factory(makeEndpoint func(addservice.Service) endpoint.Endpoint, cfg Config, logger log.Logger) sd.Factory {
+	return func(instance string) (endpoint.Endpoint, io.Closer, error) {
+		if cfg.Transport == "http" {
+			svc, err := addtransport.NewHTTPClient(instance, cfg.Client, logger, discard.NewCounter(), discard.NewCounter())
+			if err != nil {
+				return nil, nil, err
+			}
+			return makeEndpoint(svc), nil, nil
+		}
+		conn, err := grpc.Dial(instance, grpc.WithInsecure())
+		if err != nil {
+			return nil, nil, err
+		}
+		svc := addtransport.NewGRPCClient(conn, cfg.Client, logger, discard.NewCounter(), discard.NewCounter())
+		return makeEndpoint(svc), conn, nil
+	}
+}
+
+// balanced sends every call to the next instance, without retrying, so that
+// callers see each failure.
+func balanced(b lb.Balancer) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		e, err := b.Endpoint()
+		if err != nil {
+			return nil, err
+		}
+		return e(ctx, request)
+	}
+}
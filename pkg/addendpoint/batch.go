@@ -0,0 +1,124 @@
+package addendpoint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// errNoOperation is the error of a batch operation that names no method.
+var errNoOperation = errors.New("operation names no method")
+
+// MakeBatchEndpoint runs the operations of a BatchRequest on the endpoints
+// of their methods, parallelism() at a time, and collects their results in
+// order. Every failure, rejections by rate limiters included, stays with
+// its operation; the batch as a whole only fails if it is too large.
+func MakeBatchEndpoint(methods BatchMethods, maxBatch, parallelism func() int) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(BatchRequest)
+		if len(req.Operations) > maxBatch() {
+			return BatchResponse{Err: fmt.Errorf("%w: %d operations, at most %d", ErrBatchTooLarge, len(req.Operations), maxBatch())}, nil
+		}
+
+		var (
+			results = make([]OperationResult, len(req.Operations))
+			slots   = make(chan struct{}, parallelism())
+			wg      sync.WaitGroup
+		)
+		for i, op := range req.Operations {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				wg.Wait()
+				return nil, ctx.Err()
+			}
+			wg.Add(1)
+			go func(i int, op Operation) {
+				defer func() { <-slots; wg.Done() }()
+				results[i] = runOperation(ctx, methods, op)
+			}(i, op)
+		}
+		wg.Wait()
+		return BatchResponse{Results: results}, nil
+	}
+}
+
+// BatchMethods holds the endpoints the operations of a batch run on.
+type BatchMethods struct {
+	Sum, Concat, SumDecimal, Eval endpoint.Endpoint
+}
+
+func runOperation(ctx context.Context, methods BatchMethods, op Operation) OperationResult {
+	var (
+		e       endpoint.Endpoint
+		request interface{}
+	)
+	switch {
+	case op.Sum != nil:
+		e, request = methods.Sum, *op.Sum
+	case op.Concat != nil:
+		e, request = methods.Concat, *op.Concat
+	case op.SumDecimal != nil:
+		e, request = methods.SumDecimal, *op.SumDecimal
+	case op.Eval != nil:
+		e, request = methods.Eval, *op.Eval
+	default:
+		return OperationResult{Err: errNoOperation}
+	}
+	resp, err := e(ctx, request)
+	if err == nil {
+		err = resp.(endpoint.Failer).Failed()
+	}
+	if err != nil {
+		return OperationResult{Err: err}
+	}
+	var result OperationResult
+	switch r := resp.(type) {
+	case SumResponse:
+		result.Sum = &r
+	case ConcatResponse:
+		result.Concat = &r
+	case SumDecimalResponse:
+		result.SumDecimal = &r
+	case EvalResponse:
+		result.Eval = &r
+	}
+	return result
+}
+
+var _ endpoint.Failer = BatchResponse{}
+
+// BatchRequest holds operations of any method. Each Operation sets exactly
+// one of its fields.
+type BatchRequest struct {
+	Operations []Operation `json:"operations"`
+}
+
+type Operation struct {
+	Sum        *SumRequest        `json:"sum,omitempty"`
+	Concat     *ConcatRequest     `json:"concat,omitempty"`
+	SumDecimal *SumDecimalRequest `json:"sum_decimal,omitempty"`
+	Eval       *EvalRequest       `json:"eval,omitempty"`
+}
+
+// BatchResponse holds one result per operation. Err is only set when the
+// batch failed as a whole.
+type BatchResponse struct {
+	Results []OperationResult `json:"results"`
+	Err     error             `json:"-"`
+}
+
+func (r BatchResponse) Failed() error { return r.Err }
+
+// OperationResult holds either the response of the method of its operation,
+// or the error the operation failed with.
+type OperationResult struct {
+	Sum        *SumResponse
+	Concat     *ConcatResponse
+	SumDecimal *SumDecimalResponse
+	Eval       *EvalResponse
+	Err        error
+}
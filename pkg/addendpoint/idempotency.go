@@ -0,0 +1,191 @@
+package addendpoint
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"google.golang.org/grpc/codes"
+)
+
+// MaxIdempotencyKeyLen is the length of the longest key accepted.
+const MaxIdempotencyKeyLen = 255
+
+var (
+	// ErrIdempotencyKeyReused rejects a request whose key was used before
+	// for another method or payload.
+	ErrIdempotencyKeyReused = addservice.RegisterError(addservice.ErrorSpec{
+		Err:        errors.New("idempotency key reused with a different request"),
+		Reason:     "IDEMPOTENCY_KEY_REUSED",
+		HTTPStatus: http.StatusUnprocessableEntity,
+		GRPCCode:   codes.FailedPrecondition,
+	})
+	ErrInvalidIdempotencyKey = addservice.RegisterError(addservice.ErrorSpec{
+		Err:        fmt.Errorf("idempotency key longer than %d bytes", MaxIdempotencyKeyLen),
+		Reason:     "INVALID_IDEMPOTENCY_KEY",
+		HTTPStatus: http.StatusBadRequest,
+		GRPCCode:   codes.InvalidArgument,
+	})
+)
+
+// IdempotencyConfig bounds the IdempotencyStore. Results are kept for TTL,
+// and beyond MaxKeys the oldest ones are forgotten. A MaxKeys of 0 turns
+// the store off.
+type IdempotencyConfig struct {
+	TTL     time.Duration `yaml:"ttl"`
+	MaxKeys int           `yaml:"max_keys"`
+}
+
+func (c IdempotencyConfig) Validate() error {
+	if c.TTL <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	if c.MaxKeys < 0 {
+		return errors.New("max_keys must not be negative")
+	}
+	return nil
+}
+
+// IdempotencyStore remembers the responses of the requests that came with
+// an idempotency key. It is local to the instance, so only replays that
+// reach the same instance are answered from it: a replay that another
+// instance takes runs again. The gateway sends every call with a key to the
+// instance the key hashes to, retries included, which holds as long as the
+// set of instances does not change and nothing else balances the calls.
+type IdempotencyStore struct {
+	mtx     sync.Mutex
+	cfg     IdempotencyConfig
+	entries map[string]*list.Element
+	order   *list.List // of *idempotencyEntry, oldest first
+}
+
+type idempotencyEntry struct {
+	key         string
+	fingerprint [sha256.Size]byte
+	expires     time.Time     // zero until done
+	done        chan struct{} // closed once response is set
+	response    interface{}   // nil if the call failed
+}
+
+func NewIdempotencyStore(cfg IdempotencyConfig) *IdempotencyStore {
+	return &IdempotencyStore{
+		cfg:     cfg,
+		entries: map[string]*list.Element{},
+		order:   list.New(),
+	}
+}
+
+// Update applies cfg, forgetting the keys that exceed it.
+func (s *IdempotencyStore) Update(cfg IdempotencyConfig) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.cfg = cfg
+	s.evict(time.Now())
+}
+
+// claim returns the entry of key, and whether the caller has to fill it in.
+// Otherwise the entry belongs to an earlier request with the same
+// fingerprint, which may still be running.
+func (s *IdempotencyStore) claim(key string, fingerprint [sha256.Size]byte) (*idempotencyEntry, bool, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	now := time.Now()
+	s.evict(now)
+	if elem, ok := s.entries[key]; ok {
+		e := elem.Value.(*idempotencyEntry)
+		if e.fingerprint != fingerprint {
+			return nil, false, ErrIdempotencyKeyReused
+		}
+		return e, false, nil
+	}
+	e := &idempotencyEntry{key: key, fingerprint: fingerprint, done: make(chan struct{})}
+	if s.cfg.MaxKeys > 0 {
+		s.entries[key] = s.order.PushBack(e)
+		s.evict(now)
+	}
+	return e, true, nil
+}
+
+// finish stores the response of a claimed entry. Failed calls are not
+// stored, so that they can be retried with the same key.
+func (s *IdempotencyStore) finish(e *idempotencyEntry, response interface{}, err error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if err == nil {
+		e.response = response
+		e.expires = time.Now().Add(s.cfg.TTL)
+	} else if elem, ok := s.entries[e.key]; ok && elem.Value == e {
+		s.remove(elem)
+	}
+	close(e.done)
+}
+
+// evict drops entries from the oldest on while there are more than MaxKeys
+// or they have expired. Entries still running do not expire.
+func (s *IdempotencyStore) evict(now time.Time) {
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		e := elem.Value.(*idempotencyEntry)
+		if s.order.Len() <= s.cfg.MaxKeys && (e.expires.IsZero() || !now.After(e.expires)) {
+			return
+		}
+		s.remove(elem)
+	}
+}
+
+func (s *IdempotencyStore) remove(elem *list.Element) {
+	delete(s.entries, elem.Value.(*idempotencyEntry).key)
+	s.order.Remove(elem)
+}
+
+// IdempotencyMiddleware answers requests that carry an idempotency key of
+// an earlier request with the same method and payload with the response of
+// that request, waiting for it if needed, and rejects those whose method or
+// payload differ. The key is not passed on, so that the endpoints a batch
+// calls for its operations do not see it.
+func IdempotencyMiddleware(store *IdempotencyStore, method string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			key := addservice.IdempotencyKey(ctx)
+			if key == "" || store == nil {
+				return next(ctx, request)
+			}
+			if len(key) > MaxIdempotencyKeyLen {
+				return nil, ErrInvalidIdempotencyKey
+			}
+			ctx = addservice.WithIdempotencyKey(ctx, "")
+			payload, err := json.Marshal(request)
+			if err != nil {
+				return nil, err
+			}
+			fingerprint := sha256.Sum256(append([]byte(method+"\x00"), payload...))
+			for {
+				e, owner, err := store.claim(key, fingerprint)
+				if err != nil {
+					return nil, err
+				}
+				if owner {
+					response, err := next(ctx, request)
+					store.finish(e, response, err)
+					return response, err
+				}
+				select {
+				case <-e.done:
+				case <-ctx.Done():
+					return nil, ctx.Err()
+				}
+				if e.response != nil {
+					return e.response, nil
+				}
+				// The earlier request failed; take its place.
+			}
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package addendpoint
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+)
+
+// counter answers Sum with the number of calls so far, and fails when the
+// request asks for it.
+type counter struct{ calls int }
+
+func (c *counter) endpoint(_ context.Context, request interface{}) (interface{}, error) {
+	c.calls++
+	if request.(SumRequest).Mode == "fail" {
+		return nil, errors.New("failed")
+	}
+	return SumResponse{V: c.calls}, nil
+}
+
+type idempotentCall struct {
+	key     string
+	method  string
+	request SumRequest
+	want    int // value of the response, i.e. the call it comes from
+	err     error
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		calls []idempotentCall
+	}{
+		{"replay", []idempotentCall{
+			{key: "k", method: "Sum", request: SumRequest{A: 1, B: 2}, want: 1},
+			{key: "k", method: "Sum", request: SumRequest{A: 1, B: 2}, want: 1},
+		}},
+		{"no key", []idempotentCall{
+			{method: "Sum", request: SumRequest{A: 1, B: 2}, want: 1},
+			{method: "Sum", request: SumRequest{A: 1, B: 2}, want: 2},
+		}},
+		{"other keys", []idempotentCall{
+			{key: "k1", method: "Sum", request: SumRequest{A: 1, B: 2}, want: 1},
+			{key: "k2", method: "Sum", request: SumRequest{A: 1, B: 2}, want: 2},
+		}},
+		{"other payload", []idempotentCall{
+			{key: "k", method: "Sum", request: SumRequest{A: 1, B: 2}, want: 1},
+			{key: "k", method: "Sum", request: SumRequest{A: 1, B: 3}, err: ErrIdempotencyKeyReused},
+			{key: "k", method: "Sum", request: SumRequest{A: 1, B: 2}, want: 1},
+		}},
+		{"other method", []idempotentCall{
+			{key: "k", method: "Sum", request: SumRequest{A: 1, B: 2}, want: 1},
+			{key: "k", method: "BatchSum", request: SumRequest{A: 1, B: 2}, err: ErrIdempotencyKeyReused},
+		}},
+		{"failure is not kept", []idempotentCall{
+			{key: "k", method: "Sum", request: SumRequest{Mode: "fail"}, err: errors.New("failed")},
+			{key: "k", method: "Sum", request: SumRequest{Mode: "fail"}, err: errors.New("failed")},
+		}},
+		{"key too long", []idempotentCall{
+			{key: strings.Repeat("k", MaxIdempotencyKeyLen+1), method: "Sum", err: ErrInvalidIdempotencyKey},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewIdempotencyStore(IdempotencyConfig{TTL: time.Minute, MaxKeys: 10})
+			var c counter
+			runIdempotentCalls(t, store, &c, tc.calls)
+		})
+	}
+}
+
+func TestIdempotencyStoreEviction(t *testing.T) {
+	sum := SumRequest{A: 1, B: 2}
+	for _, tc := range []struct {
+		name  string
+		cfg   IdempotencyConfig
+		wait  time.Duration // before the last call
+		calls []idempotentCall
+	}{
+		{"oldest beyond max keys", IdempotencyConfig{TTL: time.Minute, MaxKeys: 2}, 0, []idempotentCall{
+			{key: "a", method: "Sum", request: sum, want: 1},
+			{key: "b", method: "Sum", request: sum, want: 2},
+			{key: "c", method: "Sum", request: sum, want: 3},
+			{key: "b", method: "Sum", request: sum, want: 2},
+			{key: "a", method: "Sum", request: sum, want: 4},
+		}},
+		{"expired", IdempotencyConfig{TTL: 10 * time.Millisecond, MaxKeys: 10}, 20 * time.Millisecond, []idempotentCall{
+			{key: "a", method: "Sum", request: sum, want: 1},
+			{key: "a", method: "Sum", request: sum, want: 2},
+		}},
+		{"not expired", IdempotencyConfig{TTL: time.Minute, MaxKeys: 10}, 20 * time.Millisecond, []idempotentCall{
+			{key: "a", method: "Sum", request: sum, want: 1},
+			{key: "a", method: "Sum", request: sum, want: 1},
+		}},
+		{"turned off", IdempotencyConfig{TTL: time.Minute, MaxKeys: 0}, 0, []idempotentCall{
+			{key: "a", method: "Sum", request: sum, want: 1},
+			{key: "a", method: "Sum", request: sum, want: 2},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewIdempotencyStore(tc.cfg)
+			var c counter
+			last := len(tc.calls) - 1
+			runIdempotentCalls(t, store, &c, tc.calls[:last])
+			time.Sleep(tc.wait)
+			runIdempotentCalls(t, store, &c, tc.calls[last:])
+		})
+	}
+}
+
+func TestIdempotencyMiddlewareWaits(t *testing.T) {
+	store := NewIdempotencyStore(IdempotencyConfig{TTL: time.Minute, MaxKeys: 10})
+	started, release := make(chan struct{}), make(chan struct{})
+	calls := 0
+	e := IdempotencyMiddleware(store, "Sum")(func(context.Context, interface{}) (interface{}, error) {
+		calls++
+		close(started)
+		<-release
+		return SumResponse{V: 3}, nil
+	})
+	ctx := addservice.WithIdempotencyKey(context.Background(), "k")
+
+	first := make(chan interface{})
+	go func() {
+		response, _ := e(ctx, SumRequest{A: 1, B: 2})
+		first <- response
+	}()
+	<-started
+
+	// A replay whose caller gives up does not wait for the first call.
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := e(canceled, SumRequest{A: 1, B: 2}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want %v, have %v", context.Canceled, err)
+	}
+
+	second := make(chan interface{})
+	go func() {
+		response, _ := e(ctx, SumRequest{A: 1, B: 2})
+		second <- response
+	}()
+	close(release)
+	if r1, r2 := <-first, <-second; r1 != r2 || calls != 1 {
+		t.Fatalf("have %v and %v after %d calls", r1, r2, calls)
+	}
+}
+
+func runIdempotentCalls(t *testing.T, store *IdempotencyStore, c *counter, calls []idempotentCall) {
+	t.Helper()
+	for i, call := range calls {
+		e := IdempotencyMiddleware(store, call.method)(c.endpoint)
+		ctx := context.Background()
+		if call.key != "" {
+			ctx = addservice.WithIdempotencyKey(ctx, call.key)
+		}
+		response, err := e(ctx, call.request)
+		switch {
+		case call.err != nil:
+			if err == nil || err.Error() != call.err.Error() {
+				t.Fatalf("call %d: want error %v, have %v", i, call.err, err)
+			}
+		case err != nil:
+			t.Fatalf("call %d: %v", i, err)
+		case response.(SumResponse).V != call.want:
+			t.Fatalf("call %d: want the response of call %d, have that of %d", i, call.want, response.(SumResponse).V)
+		}
+	}
+}
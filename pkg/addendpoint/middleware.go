@@ -2,10 +2,18 @@ package addendpoint
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func LoggingMiddleware(logger log.Logger) endpoint.Middleware {
@@ -21,3 +29,69 @@ func LoggingMiddleware(logger log.Logger) endpoint.Middleware {
 		}
 	}
 }
+
+func InstrumentingMiddleware(duration metrics.Histogram) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			defer func(begin time.Time) {
+				duration.With("success", fmt.Sprint(err == nil)).Observe(time.Since(begin).Seconds())
+			}(time.Now())
+			return next(ctx, request)
+		}
+	}
+}
+
+// RejectionMiddleware counts the requests turned away by a rate limiter
+// somewhere below it in the chain.
+func RejectionMiddleware(rejections metrics.Counter) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := next(ctx, request)
+			if errors.Is(err, ratelimit.ErrLimited) {
+				rejections.Add(1)
+			}
+			return response, err
+		}
+	}
+}
+
+// FailureMiddleware turns errors carried by a failed response back into
+// endpoint errors, unless they are registered, non-retryable service errors.
+// Put it around endpoints built with MakeSumEndpoint and friends on top of a
+// client, so that lb.Retry and friends see transport failures again.
+func FailureMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := next(ctx, request)
+			if f, ok := response.(endpoint.Failer); ok && err == nil && f.Failed() != nil {
+				if spec, ok := addservice.LookupError(f.Failed()); !ok || spec.Retryable {
+					return nil, f.Failed()
+				}
+			}
+			return response, err
+		}
+	}
+}
+
+// TracingMiddleware wraps every call in a span named operation. Both
+// transport errors and errors carried by an endpoint.Failer response are
+// recorded on the span.
+func TracingMiddleware(tracer trace.Tracer, operation string, attrs ...attribute.KeyValue) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+			ctx, span := tracer.Start(ctx, operation, trace.WithAttributes(attrs...))
+			defer func() {
+				failure := err
+				if f, ok := response.(endpoint.Failer); ok && failure == nil {
+					failure = f.Failed()
+				}
+				if failure != nil {
+					span.RecordError(failure)
+					span.SetStatus(codes.Error, failure.Error())
+				}
+				span.End()
+			}()
+			return next(ctx, request)
+		}
+	}
+}
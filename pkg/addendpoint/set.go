@@ -2,36 +2,272 @@ package addendpoint
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/kit/ratelimit"
 	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
 )
 
+func init() {
+	addservice.RegisterError(addservice.ErrorSpec{
+		Err:        ratelimit.ErrLimited,
+		Reason:     "RATE_LIMITED",
+		HTTPStatus: http.StatusTooManyRequests,
+		GRPCCode:   codes.ResourceExhausted,
+		Retryable:  true,
+	})
+}
+
+// ErrBatchTooLarge rejects a batch with more items than Config.MaxBatch.
+var ErrBatchTooLarge = addservice.RegisterError(addservice.ErrorSpec{
+	Err:        errors.New("batch too large"),
+	Reason:     "BATCH_TOO_LARGE",
+	HTTPStatus: http.StatusRequestEntityTooLarge,
+	GRPCCode:   codes.InvalidArgument,
+})
+
+// RateLimit configures a token bucket: Rate tokens per second, up to Burst.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+func (l RateLimit) Validate() error {
+	if l.Rate <= 0 || l.Burst < 1 {
+		return errors.New("rate must be positive and burst at least 1")
+	}
+	return nil
+}
+
+func (l RateLimit) NewLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(l.Rate), l.Burst)
+}
+
+// Config holds the per-endpoint rate limits. BatchSum limits batches, not
+// their items, of which there are at most MaxBatch. SumStream limits the
+// items of all streams together, which wait for their turn instead of
+// being rejected. The operations of a Batch are limited one by one, and run
+// BatchParallelism at a time.
+type Config struct {
+	Sum       RateLimit `yaml:"sum"`
+	Concat    RateLimit `yaml:"concat"`
+	Eval      RateLimit `yaml:"eval"`
+	BatchSum  RateLimit `yaml:"batch_sum"`
+	SumStream RateLimit `yaml:"sum_stream"`
+	MaxBatch  int       `yaml:"max_batch"`
+
+	BatchParallelism int `yaml:"batch_parallelism"`
+
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		Sum:       RateLimit{Rate: 1, Burst: 1},
+		Concat:    RateLimit{Rate: 1, Burst: 100},
+		Eval:      RateLimit{Rate: 1, Burst: 10},
+		BatchSum:  RateLimit{Rate: 1, Burst: 10},
+		SumStream: RateLimit{Rate: 100, Burst: 100},
+		MaxBatch:  1000,
+
+		BatchParallelism: 8,
+
+		Idempotency: IdempotencyConfig{TTL: 10 * time.Minute, MaxKeys: 10000},
+	}
+}
+
+func (c Config) Validate() error {
+	if err := c.Sum.Validate(); err != nil {
+		return fmt.Errorf("sum: %w", err)
+	}
+	if err := c.Concat.Validate(); err != nil {
+		return fmt.Errorf("concat: %w", err)
+	}
+	if err := c.Eval.Validate(); err != nil {
+		return fmt.Errorf("eval: %w", err)
+	}
+	if err := c.BatchSum.Validate(); err != nil {
+		return fmt.Errorf("batch_sum: %w", err)
+	}
+	if err := c.SumStream.Validate(); err != nil {
+		return fmt.Errorf("sum_stream: %w", err)
+	}
+	if c.MaxBatch < 1 {
+		return errors.New("max_batch must be at least 1")
+	}
+	if c.BatchParallelism < 1 {
+		return errors.New("batch_parallelism must be at least 1")
+	}
+	if err := c.Idempotency.Validate(); err != nil {
+		return fmt.Errorf("idempotency: %w", err)
+	}
+	return nil
+}
+
+// Limiters are the rate limiters in front of the endpoints, and the limits
+// of batches. They are created by the caller so that their state can be
+// observed.
+type Limiters struct {
+	Sum       *rate.Limiter
+	Concat    *rate.Limiter
+	Eval      *rate.Limiter
+	BatchSum  *rate.Limiter
+	SumStream *rate.Limiter
+
+	maxBatch         *int64
+	batchParallelism *int64
+}
+
+func NewLimiters(cfg Config) Limiters {
+	maxBatch, batchParallelism := int64(cfg.MaxBatch), int64(cfg.BatchParallelism)
+	return Limiters{
+		Sum:       cfg.Sum.NewLimiter(),
+		Concat:    cfg.Concat.NewLimiter(),
+		Eval:      cfg.Eval.NewLimiter(),
+		BatchSum:  cfg.BatchSum.NewLimiter(),
+		SumStream: cfg.SumStream.NewLimiter(),
+		maxBatch:  &maxBatch,
+
+		batchParallelism: &batchParallelism,
+	}
+}
+
+// Update applies cfg to the limiters in place, keeping their current tokens.
+func (l Limiters) Update(cfg Config) {
+	for _, u := range []struct {
+		lim *rate.Limiter
+		cfg RateLimit
+	}{
+		{l.Sum, cfg.Sum},
+		{l.Concat, cfg.Concat},
+		{l.Eval, cfg.Eval},
+		{l.BatchSum, cfg.BatchSum},
+		{l.SumStream, cfg.SumStream},
+	} {
+		u.lim.SetLimit(rate.Limit(u.cfg.Rate))
+		u.lim.SetBurst(u.cfg.Burst)
+	}
+	atomic.StoreInt64(l.maxBatch, int64(cfg.MaxBatch))
+	atomic.StoreInt64(l.batchParallelism, int64(cfg.BatchParallelism))
+}
+
+// MaxBatch returns the number of items a batch may have at most.
+func (l Limiters) MaxBatch() int {
+	return int(atomic.LoadInt64(l.maxBatch))
+}
+
+// BatchParallelism returns how many operations of a batch run at once.
+func (l Limiters) BatchParallelism() int {
+	return int(atomic.LoadInt64(l.batchParallelism))
+}
+
+// Set holds the endpoints of addsvc. SumStreamEndpoint is a streaming
+// endpoint, see Stream.
 type Set struct {
-	SumEndpoint    endpoint.Endpoint
-	ConcatEndpoint endpoint.Endpoint
+	SumEndpoint        endpoint.Endpoint
+	ConcatEndpoint     endpoint.Endpoint
+	SumDecimalEndpoint endpoint.Endpoint
+	EvalEndpoint       endpoint.Endpoint
+	BatchSumEndpoint   endpoint.Endpoint
+	SumStreamEndpoint  endpoint.Endpoint
+	BatchEndpoint      endpoint.Endpoint
 }
 
-func New(svc addservice.Service, logger log.Logger) Set {
+// New wraps the methods of svc in endpoints. Requests with an idempotency
+// key are answered from idempotency, if not nil, when they are replayed;
+// streams are not.
+func New(svc addservice.Service, logger log.Logger, duration metrics.Histogram, rejections metrics.Counter, tracer trace.Tracer, limiters Limiters, idempotency *IdempotencyStore) Set {
 	var sumEndpoint endpoint.Endpoint
 	{
 		sumEndpoint = MakeSumEndpoint(svc)
-		sumEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 1))(sumEndpoint)
+		sumEndpoint = ratelimit.NewErroringLimiter(limiters.Sum)(sumEndpoint)
+		sumEndpoint = RejectionMiddleware(rejections.With("method", "Sum"))(sumEndpoint)
+		sumEndpoint = IdempotencyMiddleware(idempotency, "Sum")(sumEndpoint)
+		sumEndpoint = TracingMiddleware(tracer, "Sum")(sumEndpoint)
 		sumEndpoint = LoggingMiddleware(log.With(logger, "method", "Sum"))(sumEndpoint)
+		sumEndpoint = InstrumentingMiddleware(duration.With("method", "Sum"))(sumEndpoint)
 	}
 	var concatEndpoint endpoint.Endpoint
 	{
 		concatEndpoint = MakeConcatEndpoint(svc)
-		concatEndpoint = ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Limit(1), 100))(concatEndpoint)
+		concatEndpoint = ratelimit.NewErroringLimiter(limiters.Concat)(concatEndpoint)
+		concatEndpoint = RejectionMiddleware(rejections.With("method", "Concat"))(concatEndpoint)
+		concatEndpoint = IdempotencyMiddleware(idempotency, "Concat")(concatEndpoint)
+		concatEndpoint = TracingMiddleware(tracer, "Concat")(concatEndpoint)
 		concatEndpoint = LoggingMiddleware(log.With(logger, "method", "Concat"))(concatEndpoint)
+		concatEndpoint = InstrumentingMiddleware(duration.With("method", "Concat"))(concatEndpoint)
+	}
+	var sumDecimalEndpoint endpoint.Endpoint
+	{
+		// Decimal sums count against the limit of Sum.
+		sumDecimalEndpoint = MakeSumDecimalEndpoint(svc)
+		sumDecimalEndpoint = ratelimit.NewErroringLimiter(limiters.Sum)(sumDecimalEndpoint)
+		sumDecimalEndpoint = RejectionMiddleware(rejections.With("method", "SumDecimal"))(sumDecimalEndpoint)
+		sumDecimalEndpoint = IdempotencyMiddleware(idempotency, "SumDecimal")(sumDecimalEndpoint)
+		sumDecimalEndpoint = TracingMiddleware(tracer, "SumDecimal")(sumDecimalEndpoint)
+		sumDecimalEndpoint = LoggingMiddleware(log.With(logger, "method", "SumDecimal"))(sumDecimalEndpoint)
+		sumDecimalEndpoint = InstrumentingMiddleware(duration.With("method", "SumDecimal"))(sumDecimalEndpoint)
+	}
+	var evalEndpoint endpoint.Endpoint
+	{
+		evalEndpoint = MakeEvalEndpoint(svc)
+		evalEndpoint = ratelimit.NewErroringLimiter(limiters.Eval)(evalEndpoint)
+		evalEndpoint = RejectionMiddleware(rejections.With("method", "Eval"))(evalEndpoint)
+		evalEndpoint = IdempotencyMiddleware(idempotency, "Eval")(evalEndpoint)
+		evalEndpoint = TracingMiddleware(tracer, "Eval")(evalEndpoint)
+		evalEndpoint = LoggingMiddleware(log.With(logger, "method", "Eval"))(evalEndpoint)
+		evalEndpoint = InstrumentingMiddleware(duration.With("method", "Eval"))(evalEndpoint)
+	}
+	var batchSumEndpoint endpoint.Endpoint
+	{
+		batchSumEndpoint = MakeBatchSumEndpoint(MakeSumEndpoint(svc), limiters.MaxBatch)
+		batchSumEndpoint = ratelimit.NewErroringLimiter(limiters.BatchSum)(batchSumEndpoint)
+		batchSumEndpoint = RejectionMiddleware(rejections.With("method", "BatchSum"))(batchSumEndpoint)
+		batchSumEndpoint = IdempotencyMiddleware(idempotency, "BatchSum")(batchSumEndpoint)
+		batchSumEndpoint = TracingMiddleware(tracer, "BatchSum")(batchSumEndpoint)
+		batchSumEndpoint = LoggingMiddleware(log.With(logger, "method", "BatchSum"))(batchSumEndpoint)
+		batchSumEndpoint = InstrumentingMiddleware(duration.With("method", "BatchSum"))(batchSumEndpoint)
+	}
+	var sumStreamEndpoint endpoint.Endpoint
+	{
+		// Items wait for the limiter rather than fail, which paces streams
+		// that send faster than they may.
+		item := ratelimit.NewDelayingLimiter(limiters.SumStream)(MakeSumEndpoint(svc))
+		sumStreamEndpoint = MakeStreamEndpoint(item)
+		sumStreamEndpoint = TracingMiddleware(tracer, "SumStream")(sumStreamEndpoint)
+		sumStreamEndpoint = LoggingMiddleware(log.With(logger, "method", "SumStream"))(sumStreamEndpoint)
+		sumStreamEndpoint = InstrumentingMiddleware(duration.With("method", "SumStream"))(sumStreamEndpoint)
+	}
+	var batchEndpoint endpoint.Endpoint
+	{
+		// Every operation goes through its own endpoint above, limits and
+		// logging included.
+		methods := BatchMethods{Sum: sumEndpoint, Concat: concatEndpoint, SumDecimal: sumDecimalEndpoint, Eval: evalEndpoint}
+		batchEndpoint = MakeBatchEndpoint(methods, limiters.MaxBatch, limiters.BatchParallelism)
+		batchEndpoint = IdempotencyMiddleware(idempotency, "Batch")(batchEndpoint)
+		batchEndpoint = TracingMiddleware(tracer, "Batch")(batchEndpoint)
+		batchEndpoint = LoggingMiddleware(log.With(logger, "method", "Batch"))(batchEndpoint)
+		batchEndpoint = InstrumentingMiddleware(duration.With("method", "Batch"))(batchEndpoint)
 	}
 	return Set{
-		SumEndpoint:    sumEndpoint,
-		ConcatEndpoint: concatEndpoint,
+		SumEndpoint:        sumEndpoint,
+		ConcatEndpoint:     concatEndpoint,
+		SumDecimalEndpoint: sumDecimalEndpoint,
+		EvalEndpoint:       evalEndpoint,
+		BatchSumEndpoint:   batchSumEndpoint,
+		SumStreamEndpoint:  sumStreamEndpoint,
+		BatchEndpoint:      batchEndpoint,
 	}
 }
 
@@ -44,8 +280,13 @@ func (s Set) Sum(ctx context.Context, a, b int) (int, error) {
 	return response.V, response.Err
 }
 
-func (s Set) Concat(ctx context.Context, a, b string) (string, error) {
-	resp, err := s.ConcatEndpoint(ctx, ConcatRequest{A: a, B: b})
+func (s Set) Concat(ctx context.Context, a, b string, opts addservice.ConcatOptions) (string, error) {
+	resp, err := s.ConcatEndpoint(ctx, ConcatRequest{
+		A:             a,
+		B:             b,
+		LengthUnit:    string(opts.LengthUnit),
+		Normalization: string(opts.Normalization),
+	})
 	if err != nil {
 		return "", err
 	}
@@ -53,30 +294,123 @@ func (s Set) Concat(ctx context.Context, a, b string) (string, error) {
 	return response.V, response.Err
 }
 
+func (s Set) SumDecimal(ctx context.Context, a, b string, mode addservice.Mode) (string, error) {
+	resp, err := s.SumDecimalEndpoint(ctx, SumDecimalRequest{A: a, B: b, Mode: string(mode)})
+	if err != nil {
+		return "", err
+	}
+	response := resp.(SumDecimalResponse)
+	return response.V, response.Err
+}
+
+func (s Set) Eval(ctx context.Context, expr string, vars map[string]addservice.Value) (addservice.Value, error) {
+	req := EvalRequest{Expr: expr}
+	if len(vars) > 0 {
+		req.Vars = make(map[string]Value, len(vars))
+		for name, v := range vars {
+			req.Vars[name] = NewValue(v)
+		}
+	}
+	resp, err := s.EvalEndpoint(ctx, req)
+	if err != nil {
+		return addservice.Value{}, err
+	}
+	response := resp.(EvalResponse)
+	return response.V.Service(), response.Err
+}
+
+// MakeSumEndpoint calls Sum, or SumDecimal for requests that pick a mode.
 func MakeSumEndpoint(s addservice.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(SumRequest)
-		v, err := s.Sum(ctx, req.A, req.B)
-		return SumResponse{V: v, Err: err}, nil
+		if req.Mode == "" {
+			v, err := s.Sum(ctx, req.A, req.B)
+			return SumResponse{V: v, Err: err}, nil
+		}
+		d, err := s.SumDecimal(ctx, strconv.Itoa(req.A), strconv.Itoa(req.B), addservice.Mode(req.Mode))
+		if err != nil {
+			return SumResponse{Err: err}, nil
+		}
+		v, err := strconv.Atoi(d)
+		if err != nil {
+			return SumResponse{Err: addservice.ErrIntOverflow}, nil
+		}
+		return SumResponse{V: v}, nil
+	}
+}
+
+func MakeSumDecimalEndpoint(s addservice.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(SumDecimalRequest)
+		v, err := s.SumDecimal(ctx, req.A, req.B, addservice.Mode(req.Mode))
+		return SumDecimalResponse{V: v, Err: err}, nil
+	}
+}
+
+func MakeEvalEndpoint(s addservice.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
+		req := request.(EvalRequest)
+		vars := make(map[string]addservice.Value, len(req.Vars))
+		for name, v := range req.Vars {
+			vars[name] = v.Service()
+		}
+		v, err := s.Eval(ctx, req.Expr, vars)
+		if err != nil {
+			return EvalResponse{Err: err}, nil
+		}
+		return EvalResponse{V: NewValue(v)}, nil
 	}
 }
 
 func MakeConcatEndpoint(s addservice.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (response interface{}, err error) {
 		req := request.(ConcatRequest)
-		v, err := s.Concat(ctx, req.A, req.B)
+		v, err := s.Concat(ctx, req.A, req.B, addservice.ConcatOptions{
+			LengthUnit:    addservice.LengthUnit(req.LengthUnit),
+			Normalization: addservice.Normalization(req.Normalization),
+		})
 		return ConcatResponse{V: v, Err: err}, nil
 	}
 }
 
+// MakeBatchSumEndpoint calls sum, an endpoint taking a SumRequest, for
+// every item of a BatchSumRequest in turn. Business errors stay with their
+// item, while errors returned by sum, or the context being done, fail the
+// batch.
+func MakeBatchSumEndpoint(sum endpoint.Endpoint, maxBatch func() int) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(BatchSumRequest)
+		if len(req.Items) > maxBatch() {
+			return BatchSumResponse{Err: fmt.Errorf("%w: %d items, at most %d", ErrBatchTooLarge, len(req.Items), maxBatch())}, nil
+		}
+		results := make([]SumResponse, len(req.Items))
+		for i, item := range req.Items {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			resp, err := sum(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			results[i] = resp.(SumResponse)
+		}
+		return BatchSumResponse{Results: results}, nil
+	}
+}
+
 var (
 	_ endpoint.Failer = SumResponse{}
 	_ endpoint.Failer = ConcatResponse{}
+	_ endpoint.Failer = SumDecimalResponse{}
+	_ endpoint.Failer = EvalResponse{}
+	_ endpoint.Failer = BatchSumResponse{}
 )
 
+// SumRequest may pick the mode of the sum, see addservice.Mode.
 type SumRequest struct {
-	A int `json:"a"`
-	B int `json:"b"`
+	A    int    `json:"a"`
+	B    int    `json:"b"`
+	Mode string `json:"mode,omitempty"`
 }
 
 type SumResponse struct {
@@ -86,9 +420,66 @@ type SumResponse struct {
 
 func (r SumResponse) Failed() error { return r.Err }
 
+// SumDecimalRequest carries its operands in decimal, and so does its
+// response, which loses no precision in JSON.
+type SumDecimalRequest struct {
+	A    string `json:"a"`
+	B    string `json:"b"`
+	Mode string `json:"mode,omitempty"`
+}
+
+type SumDecimalResponse struct {
+	V   string `json:"v"`
+	Err error  `json:"-"`
+}
+
+func (r SumDecimalResponse) Failed() error { return r.Err }
+
+// Value is an integer or a string, whichever is set.
+type Value struct {
+	Int *int    `json:"int,omitempty"`
+	Str *string `json:"str,omitempty"`
+}
+
+func NewValue(v addservice.Value) Value {
+	if v.IsStr {
+		return Value{Str: &v.Str}
+	}
+	return Value{Int: &v.Int}
+}
+
+// Service returns v as the service sees it. A Value with neither field set
+// is the integer 0.
+func (v Value) Service() addservice.Value {
+	switch {
+	case v.Str != nil:
+		return addservice.StrValue(*v.Str)
+	case v.Int != nil:
+		return addservice.IntValue(*v.Int)
+	default:
+		return addservice.Value{}
+	}
+}
+
+type EvalRequest struct {
+	Expr string           `json:"expr"`
+	Vars map[string]Value `json:"vars,omitempty"`
+}
+
+type EvalResponse struct {
+	V   Value `json:"v"`
+	Err error `json:"-"`
+}
+
+func (r EvalResponse) Failed() error { return r.Err }
+
+// ConcatRequest may pick the options of the concatenation, see
+// addservice.ConcatOptions.
 type ConcatRequest struct {
-	A string `json:"a"`
-	B string `json:"b"`
+	A             string `json:"a"`
+	B             string `json:"b"`
+	LengthUnit    string `json:"lengthUnit,omitempty"`
+	Normalization string `json:"normalization,omitempty"`
 }
 
 type ConcatResponse struct {
@@ -97,3 +488,16 @@ type ConcatResponse struct {
 }
 
 func (r ConcatResponse) Failed() error { return r.Err }
+
+type BatchSumRequest struct {
+	Items []SumRequest `json:"items"`
+}
+
+// BatchSumResponse holds one response per item, whose Err tells whether the
+// item failed. Err is only set when the batch failed as a whole.
+type BatchSumResponse struct {
+	Results []SumResponse `json:"results"`
+	Err     error         `json:"-"`
+}
+
+func (r BatchSumResponse) Failed() error { return r.Err }
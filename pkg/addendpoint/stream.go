@@ -0,0 +1,46 @@
+package addendpoint
+
+import (
+	"context"
+	"io"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// Stream is the request of a streaming endpoint. Recv returns the requests
+// of the stream until io.EOF, and Send takes one response per request, in
+// order. Streaming endpoints return a nil response, or an error that ends
+// the stream; failures of single items travel in their responses.
+//
+// Carrying streams in a plain endpoint.Endpoint keeps the middlewares of
+// this package, and load balancing, working for them, with every stream
+// counting as one call.
+type Stream struct {
+	Recv func() (interface{}, error)
+	Send func(response interface{}) error
+}
+
+// MakeStreamEndpoint returns a streaming endpoint that calls e for each
+// request of the stream in turn. Business errors reach the caller in the
+// responses of e, while errors returned by e end the stream.
+func MakeStreamEndpoint(e endpoint.Endpoint) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		s := request.(Stream)
+		for {
+			req, err := s.Recv()
+			if err == io.EOF {
+				return nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			resp, err := e(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.Send(resp); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
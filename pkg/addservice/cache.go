@@ -0,0 +1,292 @@
+package addservice
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheConfig bounds the Cache. Results are kept for TTL, and beyond
+// MaxEntries the least recently used ones are forgotten. A MaxEntries of 0
+// turns caching off. Timeout bounds the calls made to fill the cache, which
+// do not follow the deadline of any caller.
+type CacheConfig struct {
+	MaxEntries int           `yaml:"max_entries"`
+	TTL        time.Duration `yaml:"ttl"`
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{MaxEntries: 10000, TTL: time.Minute, Timeout: 10 * time.Second}
+}
+
+func (c CacheConfig) Validate() error {
+	if c.MaxEntries < 0 {
+		return errors.New("max_entries must not be negative")
+	}
+	if c.TTL <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	if c.Timeout <= 0 {
+		return errors.New("timeout must be positive")
+	}
+	return nil
+}
+
+// CacheControl tells how a single call uses the cache, as the
+// Cache-Control header of HTTP requests does. NoCache skips the lookup but
+// still stores the result, NoStore bypasses the cache altogether, and a
+// positive MaxAge only accepts results that are at most that old.
+type CacheControl struct {
+	NoCache bool
+	NoStore bool
+	MaxAge  time.Duration
+}
+
+// ParseCacheControl reads the directives of a Cache-Control header that
+// apply to requests. A max-age of 0 stands for no-cache, and directives it
+// does not know are ignored.
+func ParseCacheControl(s string) CacheControl {
+	var cc CacheControl
+	for _, directive := range strings.Split(s, ",") {
+		name, value := strings.TrimSpace(directive), ""
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name, value = strings.TrimSpace(name[:i]), strings.Trim(strings.TrimSpace(name[i+1:]), `"`)
+		}
+		switch strings.ToLower(name) {
+		case "no-cache":
+			cc.NoCache = true
+		case "no-store":
+			cc.NoStore = true
+		case "max-age":
+			if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+				cc.MaxAge = time.Duration(seconds) * time.Second
+				cc.NoCache = cc.NoCache || seconds == 0
+			}
+		}
+	}
+	return cc
+}
+
+// String returns cc as a Cache-Control header.
+func (cc CacheControl) String() string {
+	var directives []string
+	if cc.NoCache {
+		directives = append(directives, "no-cache")
+	}
+	if cc.NoStore {
+		directives = append(directives, "no-store")
+	}
+	if cc.MaxAge > 0 {
+		directives = append(directives, "max-age="+strconv.Itoa(int(cc.MaxAge/time.Second)))
+	}
+	return strings.Join(directives, ", ")
+}
+
+type contextKey int
+
+const (
+	cacheControlContextKey contextKey = iota
+	idempotencyKeyContextKey
+)
+
+// WithCacheControl returns a context carrying cc, as the transports receive
+// it from the caller.
+func WithCacheControl(ctx context.Context, cc CacheControl) context.Context {
+	return context.WithValue(ctx, cacheControlContextKey, cc)
+}
+
+// CacheControlFrom returns the CacheControl ctx carries, the zero one if
+// none.
+func CacheControlFrom(ctx context.Context) CacheControl {
+	cc, _ := ctx.Value(cacheControlContextKey).(CacheControl)
+	return cc
+}
+
+// WithIdempotencyKey returns a context carrying key, as the transports
+// receive it from the caller. addendpoint.IdempotencyMiddleware acts on it;
+// the cache only lets keyed calls through.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyContextKey, key)
+}
+
+// IdempotencyKey returns the key ctx carries, if any.
+func IdempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyContextKey).(string)
+	return key
+}
+
+// Cache is an LRU cache of results, shared by the callers of
+// CachingMiddleware.
+type Cache struct {
+	mtx     sync.Mutex
+	cfg     CacheConfig
+	entries map[string]*list.Element
+	lru     *list.List // of *cacheEntry, most recently used first
+	group   singleflight.Group
+	lookups metrics.Counter
+}
+
+type cacheEntry struct {
+	key    string
+	value  interface{}
+	stored time.Time
+}
+
+// NewCache returns a cache counting its lookups in lookups, by method and
+// result: hit, miss or bypass.
+func NewCache(cfg CacheConfig, lookups metrics.Counter) *Cache {
+	return &Cache{
+		cfg:     cfg,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		lookups: lookups,
+	}
+}
+
+// Update applies cfg and forgets every result, which may have been computed
+// under other limits.
+func (c *Cache) Update(cfg CacheConfig) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.cfg = cfg
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+}
+
+func (c *Cache) config() CacheConfig {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.cfg
+}
+
+// get returns the result stored under key, unless it is older than the TTL
+// or maxAge, if positive.
+func (c *Cache) get(key string, maxAge time.Duration) (interface{}, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*cacheEntry)
+	age := time.Since(e.stored)
+	if age > c.cfg.TTL {
+		delete(c.entries, key)
+		c.lru.Remove(elem)
+		return nil, false
+	}
+	if maxAge > 0 && age > maxAge {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return e.value, true
+}
+
+func (c *Cache) put(key string, value interface{}) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.lru.Remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&cacheEntry{key: key, value: value, stored: time.Now()})
+	for c.lru.Len() > c.cfg.MaxEntries {
+		elem := c.lru.Back()
+		delete(c.entries, elem.Value.(*cacheEntry).key)
+		c.lru.Remove(elem)
+	}
+}
+
+// do answers a call of method from the cache if it can, and otherwise
+// makes it with call, at most once at a time per key and cache control:
+// concurrent callers share the result of the first call, while each of them
+// waits no longer than its own context allows. As that call answers them
+// all, it runs on a context of its own, with the cache control, the span
+// context of the caller that started it and the Timeout, but none of the
+// other values, deadline or cancellation of any caller. Only successful
+// results are stored. Calls with an idempotency key bypass the cache, so
+// that the key reaches the service.
+func (c *Cache) do(ctx context.Context, method, key string, call func(context.Context) (interface{}, error)) (interface{}, error) {
+	cc, cfg := CacheControlFrom(ctx), c.config()
+	if cc.NoStore || cfg.MaxEntries == 0 || IdempotencyKey(ctx) != "" {
+		c.lookups.With("method", method, "result", "bypass").Add(1)
+		return call(ctx)
+	}
+	key = method + " " + key
+	if !cc.NoCache {
+		if v, ok := c.get(key, cc.MaxAge); ok {
+			c.lookups.With("method", method, "result", "hit").Add(1)
+			return v, nil
+		}
+	}
+	c.lookups.With("method", method, "result", "miss").Add(1)
+	span := trace.SpanContextFromContext(ctx)
+	results := c.group.DoChan(key+" "+cc.String(), func() (interface{}, error) {
+		detached := trace.ContextWithSpanContext(WithCacheControl(context.Background(), cc), span)
+		ctx, cancel := context.WithTimeout(detached, cfg.Timeout)
+		defer cancel()
+		v, err := call(ctx)
+		if err == nil {
+			c.put(key, v)
+		}
+		return v, err
+	})
+	select {
+	case res := <-results:
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// CachingMiddleware answers the pure methods, Sum and Concat, from cache,
+// as far as the CacheControl of the context allows. The other methods are
+// passed on.
+func CachingMiddleware(cache *Cache) Middleware {
+	return func(next Service) Service {
+		return cachingMiddleware{cache, next}
+	}
+}
+
+type cachingMiddleware struct {
+	cache *Cache
+	next  Service
+}
+
+func (mw cachingMiddleware) Sum(ctx context.Context, a, b int) (int, error) {
+	v, err := mw.cache.do(ctx, "Sum", fmt.Sprint(a, b), func(ctx context.Context) (interface{}, error) {
+		return mw.next.Sum(ctx, a, b)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return v.(int), nil
+}
+
+func (mw cachingMiddleware) Concat(ctx context.Context, a, b string, opts ConcatOptions) (string, error) {
+	key := fmt.Sprintf("%q %q %q %q", a, b, opts.LengthUnit, opts.Normalization)
+	v, err := mw.cache.do(ctx, "Concat", key, func(ctx context.Context) (interface{}, error) {
+		return mw.next.Concat(ctx, a, b, opts)
+	})
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+func (mw cachingMiddleware) SumDecimal(ctx context.Context, a, b string, mode Mode) (string, error) {
+	return mw.next.SumDecimal(ctx, a, b, mode)
+}
+
+func (mw cachingMiddleware) Eval(ctx context.Context, expr string, vars map[string]Value) (Value, error) {
+	return mw.next.Eval(ctx, expr, vars)
+}
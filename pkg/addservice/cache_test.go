@@ -0,0 +1,185 @@
+package addservice
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/discard"
+)
+
+func TestParseCacheControl(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		want   CacheControl
+	}{
+		{"", CacheControl{}},
+		{"no-cache", CacheControl{NoCache: true}},
+		{"No-Store", CacheControl{NoStore: true}},
+		{"max-age=30", CacheControl{MaxAge: 30 * time.Second}},
+		{`max-age="30", no-cache`, CacheControl{NoCache: true, MaxAge: 30 * time.Second}},
+		{"max-age=0", CacheControl{NoCache: true}},
+		{"max-age=-1, private", CacheControl{}},
+	} {
+		if got := ParseCacheControl(tc.header); got != tc.want {
+			t.Errorf("%q: want %+v, have %+v", tc.header, tc.want, got)
+		}
+	}
+}
+
+func TestCache(t *testing.T) {
+	type lookup struct {
+		cc   CacheControl
+		wait time.Duration // before the lookup
+		want int           // value of the result, i.e. the call it comes from
+	}
+	for _, tc := range []struct {
+		name    string
+		cfg     CacheConfig
+		lookups []lookup
+	}{
+		{"hit", CacheConfig{MaxEntries: 10, TTL: time.Minute}, []lookup{
+			{want: 1},
+			{want: 1},
+		}},
+		{"expired", CacheConfig{MaxEntries: 10, TTL: 10 * time.Millisecond}, []lookup{
+			{want: 1},
+			{wait: 20 * time.Millisecond, want: 2},
+		}},
+		{"max-age", CacheConfig{MaxEntries: 10, TTL: time.Minute}, []lookup{
+			{want: 1},
+			{cc: CacheControl{MaxAge: time.Minute}, want: 1},
+			{wait: 1100 * time.Millisecond, cc: CacheControl{MaxAge: time.Second}, want: 2},
+			{cc: CacheControl{MaxAge: time.Second}, want: 2},
+		}},
+		{"no-cache", CacheConfig{MaxEntries: 10, TTL: time.Minute}, []lookup{
+			{want: 1},
+			{cc: CacheControl{NoCache: true}, want: 2},
+			{want: 2},
+		}},
+		{"no-store", CacheConfig{MaxEntries: 10, TTL: time.Minute}, []lookup{
+			{cc: CacheControl{NoStore: true}, want: 1},
+			{want: 2},
+			{cc: CacheControl{NoStore: true}, want: 3},
+			{want: 2},
+		}},
+		{"turned off", CacheConfig{MaxEntries: 0, TTL: time.Minute}, []lookup{
+			{want: 1},
+			{want: 2},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.cfg.Timeout = time.Second
+			c := NewCache(tc.cfg, discard.NewCounter())
+			calls := 0
+			call := func(context.Context) (interface{}, error) {
+				calls++
+				return calls, nil
+			}
+			for i, l := range tc.lookups {
+				time.Sleep(l.wait)
+				v, err := c.do(WithCacheControl(context.Background(), l.cc), "Sum", "1 2", call)
+				if err != nil {
+					t.Fatalf("lookup %d: %v", i, err)
+				}
+				if v != l.want {
+					t.Fatalf("lookup %d: want the result of call %d, have that of %d", i, l.want, v)
+				}
+			}
+		})
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c := NewCache(CacheConfig{MaxEntries: 2, TTL: time.Minute, Timeout: time.Second}, discard.NewCounter())
+	calls := map[string]int{}
+	get := func(key string) {
+		c.do(context.Background(), "Sum", key, func(context.Context) (interface{}, error) {
+			calls[key]++
+			return key, nil
+		})
+	}
+	get("a")
+	get("b")
+	get("a") // b is now the least recently used
+	get("c")
+	get("a")
+	get("b")
+	if want := map[string]int{"a": 1, "b": 2, "c": 1}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("want calls %v, have %v", want, calls)
+	}
+}
+
+func TestCacheErrorsAreNotStored(t *testing.T) {
+	c := NewCache(CacheConfig{MaxEntries: 10, TTL: time.Minute, Timeout: time.Second}, discard.NewCounter())
+	calls := 0
+	for i := 0; i < 2; i++ {
+		_, err := c.do(context.Background(), "Sum", "0 0", func(context.Context) (interface{}, error) {
+			calls++
+			return nil, ErrTwoZeroes
+		})
+		if !errors.Is(err, ErrTwoZeroes) {
+			t.Fatalf("want %v, have %v", ErrTwoZeroes, err)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("want 2 calls, have %d", calls)
+	}
+}
+
+func TestCacheSingleflight(t *testing.T) {
+	c := NewCache(CacheConfig{MaxEntries: 10, TTL: time.Minute, Timeout: time.Second}, discard.NewCounter())
+	var (
+		mtx      sync.Mutex
+		calls    int
+		deadline time.Time
+		release  = make(chan struct{})
+	)
+	type ctxKey struct{}
+	call := func(ctx context.Context) (interface{}, error) {
+		mtx.Lock()
+		calls++
+		deadline, _ = ctx.Deadline()
+		mtx.Unlock()
+		if ctx.Value(ctxKey{}) != nil {
+			t.Error("the shared call sees the values of a caller")
+		}
+		<-release
+		return 42, nil
+	}
+
+	// The first caller gives up early; the others still get the result.
+	first, cancel := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "first"), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.do(first, "Sum", "40 2", call); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want %v, have %v", context.DeadlineExceeded, err)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]interface{}, 8)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = c.do(context.Background(), "Sum", "40 2", call)
+		}(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, v := range results {
+		if v != 42 {
+			t.Fatalf("caller %d: want 42, have %v", i, v)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("want 1 call, have %d", calls)
+	}
+	if time.Until(deadline) < 500*time.Millisecond {
+		t.Fatalf("the shared call ran until %v, not the cache's timeout", deadline)
+	}
+}
@@ -0,0 +1,159 @@
+package addservice
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+)
+
+// ErrorSpec describes how a service error is represented on the wire. Both
+// the HTTP and the gRPC transports consult it, so a new error only needs to
+// be registered once.
+type ErrorSpec struct {
+	Err        error
+	Reason     string
+	HTTPStatus int
+	GRPCCode   codes.Code
+	Retryable  bool
+}
+
+var (
+	ErrTwoZeroes = RegisterError(ErrorSpec{
+		Err:        errors.New("can't sum two zeroes"),
+		Reason:     "TWO_ZEROES",
+		HTTPStatus: http.StatusBadRequest,
+		GRPCCode:   codes.InvalidArgument,
+	})
+	ErrIntOverflow = RegisterError(ErrorSpec{
+		Err:        errors.New("integer overflow"),
+		Reason:     "INT_OVERFLOW",
+		HTTPStatus: http.StatusBadRequest,
+		GRPCCode:   codes.InvalidArgument,
+	})
+	ErrMaxSizeExceeded = RegisterError(ErrorSpec{
+		Err:        errors.New("result exceeds maximum size"),
+		Reason:     "MAX_SIZE_EXCEEDED",
+		HTTPStatus: http.StatusBadRequest,
+		GRPCCode:   codes.ResourceExhausted,
+	})
+	ErrInvalidNumber = RegisterError(ErrorSpec{
+		Err:        errors.New("invalid decimal integer"),
+		Reason:     "INVALID_NUMBER",
+		HTTPStatus: http.StatusBadRequest,
+		GRPCCode:   codes.InvalidArgument,
+	})
+	ErrUnknownMode = RegisterError(ErrorSpec{
+		Err:        errors.New("unknown mode"),
+		Reason:     "UNKNOWN_MODE",
+		HTTPStatus: http.StatusBadRequest,
+		GRPCCode:   codes.InvalidArgument,
+	})
+	ErrUnknownOption = RegisterError(ErrorSpec{
+		Err:        errors.New("unknown option"),
+		Reason:     "UNKNOWN_OPTION",
+		HTTPStatus: http.StatusBadRequest,
+		GRPCCode:   codes.InvalidArgument,
+	})
+	// ErrInvalidUTF8 answers JSON, MessagePack and form bodies of the HTTP
+	// transport. Protobuf refuses such strings while decoding: protobuf
+	// bodies, and any body the gateway transcodes to gRPC, get
+	// INVALID_REQUEST, and gRPC calls codes.Internal.
+	ErrInvalidUTF8 = RegisterError(ErrorSpec{
+		Err:        errors.New("invalid UTF-8"),
+		Reason:     "INVALID_UTF8",
+		HTTPStatus: http.StatusBadRequest,
+		GRPCCode:   codes.InvalidArgument,
+	})
+	ErrInvalidExpression = RegisterError(ErrorSpec{
+		Err:        errors.New("invalid expression"),
+		Reason:     "INVALID_EXPRESSION",
+		HTTPStatus: http.StatusBadRequest,
+		GRPCCode:   codes.InvalidArgument,
+	})
+	ErrDivisionByZero = RegisterError(ErrorSpec{
+		Err:        errors.New("division by zero"),
+		Reason:     "DIVISION_BY_ZERO",
+		HTTPStatus: http.StatusBadRequest,
+		GRPCCode:   codes.InvalidArgument,
+	})
+)
+
+var registry = struct {
+	sync.RWMutex
+	specs []ErrorSpec
+}{}
+
+// RegisterError adds spec to the catalogue and returns spec.Err, so that
+// sentinel errors can be declared and registered in one statement. It panics
+// if the error or its reason is already registered.
+func RegisterError(spec ErrorSpec) error {
+	if spec.Err == nil || spec.Reason == "" {
+		panic("addservice: error spec needs both Err and Reason")
+	}
+	registry.Lock()
+	defer registry.Unlock()
+	for _, s := range registry.specs {
+		if s.Err == spec.Err || s.Reason == spec.Reason {
+			panic("addservice: duplicate error registration for " + spec.Reason)
+		}
+	}
+	registry.specs = append(registry.specs, spec)
+	return spec.Err
+}
+
+// LookupError returns the spec of the first registered error that err wraps.
+func LookupError(err error) (ErrorSpec, bool) {
+	if err == nil {
+		return ErrorSpec{}, false
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, s := range registry.specs {
+		if errors.Is(err, s.Err) {
+			return s, true
+		}
+	}
+	return ErrorSpec{}, false
+}
+
+// ErrorReason returns the registered reason for err, or "UNKNOWN".
+func ErrorReason(err error) string {
+	if spec, ok := LookupError(err); ok {
+		return spec.Reason
+	}
+	return "UNKNOWN"
+}
+
+// LookupReason returns the spec registered under reason.
+func LookupReason(reason string) (ErrorSpec, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, s := range registry.specs {
+		if s.Reason == reason {
+			return s, true
+		}
+	}
+	return ErrorSpec{}, false
+}
+
+// LookupMessage returns the spec whose error message is msg. It only exists
+// for peers that still send bare error strings.
+func LookupMessage(msg string) (ErrorSpec, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+	for _, s := range registry.specs {
+		if s.Err.Error() == msg {
+			return s, true
+		}
+	}
+	return ErrorSpec{}, false
+}
+
+// Errors returns all registered errors, in registration order.
+func Errors() []ErrorSpec {
+	registry.RLock()
+	defer registry.RUnlock()
+	return append([]ErrorSpec(nil), registry.specs...)
+}
@@ -0,0 +1,387 @@
+package addservice
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxEvalDepth bounds the nesting of expressions, whatever their length.
+const maxEvalDepth = 100
+
+// Value is the value of an expression or of one of its variables: an
+// integer or, if IsStr, a string.
+type Value struct {
+	Int   int
+	Str   string
+	IsStr bool
+}
+
+func IntValue(n int) Value { return Value{Int: n} }
+
+func StrValue(s string) Value { return Value{Str: s, IsStr: true} }
+
+func (v Value) String() string {
+	if v.IsStr {
+		return strconv.Quote(v.Str)
+	}
+	return strconv.Itoa(v.Int)
+}
+
+func (v Value) typeName() string {
+	if v.IsStr {
+		return "string"
+	}
+	return "int"
+}
+
+// evaluator evaluates an expression while parsing it. Every integer it comes
+// across, literal, variable or intermediate result, has to be within the
+// bounds of Sum, and every string within the size limit of Concat, in the
+// length unit of the deployment.
+type evaluator struct {
+	expr     string
+	pos      int
+	depth    int
+	vars     map[string]Value
+	min, max int64
+	maxLen   int
+	unit     LengthUnit
+}
+
+func eval(cfg Config, expr string, vars map[string]Value) (Value, error) {
+	if len(expr) > cfg.MaxExprLen {
+		return Value{}, fmt.Errorf("%w: longer than %d bytes", ErrInvalidExpression, cfg.MaxExprLen)
+	}
+	e := &evaluator{
+		expr:   expr,
+		vars:   vars,
+		min:    int64(cfg.IntMin),
+		max:    int64(cfg.IntMax),
+		maxLen: cfg.MaxLen,
+	}
+	e.unit, _ = ParseLengthUnit(string(cfg.LengthUnit))
+	if cfg.Mode != ModeBounded {
+		e.min, e.max = math.MinInt64, math.MaxInt64
+	}
+	v, err := e.expression()
+	if err != nil {
+		return Value{}, err
+	}
+	if e.skipSpace(); e.pos < len(e.expr) {
+		return Value{}, e.errorf("unexpected %q", e.expr[e.pos])
+	}
+	return v, nil
+}
+
+func (e *evaluator) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: at offset %d: %s", ErrInvalidExpression, e.pos, fmt.Sprintf(format, args...))
+}
+
+func (e *evaluator) skipSpace() {
+	for e.pos < len(e.expr) && strings.IndexByte(" \t\r\n", e.expr[e.pos]) >= 0 {
+		e.pos++
+	}
+}
+
+// accept consumes c if it comes next.
+func (e *evaluator) accept(c byte) bool {
+	if e.skipSpace(); e.pos < len(e.expr) && e.expr[e.pos] == c {
+		e.pos++
+		return true
+	}
+	return false
+}
+
+// expression = term { ("+" | "-") term }
+func (e *evaluator) expression() (Value, error) {
+	if e.depth++; e.depth > maxEvalDepth {
+		return Value{}, e.errorf("nested too deeply")
+	}
+	defer func() { e.depth-- }()
+
+	v, err := e.term()
+	for err == nil {
+		var op byte
+		switch {
+		case e.accept('+'):
+			op = '+'
+		case e.accept('-'):
+			op = '-'
+		default:
+			return v, nil
+		}
+		var w Value
+		if w, err = e.term(); err == nil {
+			v, err = e.binary(op, v, w)
+		}
+	}
+	return Value{}, err
+}
+
+// term = unary { ("*" | "/" | "%") unary }
+func (e *evaluator) term() (Value, error) {
+	v, err := e.unary()
+	for err == nil {
+		var op byte
+		switch {
+		case e.accept('*'):
+			op = '*'
+		case e.accept('/'):
+			op = '/'
+		case e.accept('%'):
+			op = '%'
+		default:
+			return v, nil
+		}
+		var w Value
+		if w, err = e.unary(); err == nil {
+			v, err = e.binary(op, v, w)
+		}
+	}
+	return Value{}, err
+}
+
+// unary = ("-" | "+") unary | primary
+func (e *evaluator) unary() (Value, error) {
+	var op byte
+	switch {
+	case e.accept('-'):
+		op = '-'
+	case e.accept('+'):
+		op = '+'
+	default:
+		return e.primary()
+	}
+	// Signs nest like parentheses do.
+	if e.depth++; e.depth > maxEvalDepth {
+		return Value{}, e.errorf("nested too deeply")
+	}
+	defer func() { e.depth-- }()
+
+	v, err := e.unary()
+	switch {
+	case err != nil:
+		return Value{}, err
+	case op == '-':
+		return e.binary('-', IntValue(0), v)
+	case v.IsStr:
+		return Value{}, e.errorf("unary + on a string")
+	default:
+		return v, nil
+	}
+}
+
+// primary = integer | string | name [ "(" [ expression { "," expression } ] ")" ] | "(" expression ")"
+func (e *evaluator) primary() (Value, error) {
+	if e.accept('(') {
+		v, err := e.expression()
+		if err != nil {
+			return Value{}, err
+		}
+		if !e.accept(')') {
+			return Value{}, e.errorf("missing )")
+		}
+		return v, nil
+	}
+	if e.pos == len(e.expr) {
+		return Value{}, e.errorf("unexpected end")
+	}
+	start := e.pos
+	switch c := e.expr[e.pos]; {
+	case c >= '0' && c <= '9':
+		for e.pos < len(e.expr) && e.expr[e.pos] >= '0' && e.expr[e.pos] <= '9' {
+			e.pos++
+		}
+		n, ok := new(big.Int).SetString(e.expr[start:e.pos], 10)
+		if !ok {
+			return Value{}, e.errorf("bad integer")
+		}
+		return e.checkInt(n)
+	case c == '"':
+		quoted, err := strconv.QuotedPrefix(e.expr[e.pos:])
+		if err != nil {
+			return Value{}, e.errorf("unterminated string")
+		}
+		e.pos += len(quoted)
+		s, err := strconv.Unquote(quoted)
+		if err != nil {
+			return Value{}, e.errorf("bad string")
+		}
+		return e.checkStr(s)
+	case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+		for e.pos < len(e.expr) && isNameByte(e.expr[e.pos]) {
+			e.pos++
+		}
+		name := e.expr[start:e.pos]
+		if e.accept('(') {
+			if !builtins[name] {
+				e.pos = start
+				return Value{}, e.errorf("unknown function %s", name)
+			}
+			return e.call(name)
+		}
+		v, ok := e.vars[name]
+		if !ok {
+			e.pos = start
+			return Value{}, e.errorf("undefined variable %s", name)
+		}
+		if v.IsStr {
+			return e.checkStr(v.Str)
+		}
+		return e.checkInt(big.NewInt(int64(v.Int)))
+	default:
+		return Value{}, e.errorf("unexpected %q", c)
+	}
+}
+
+var builtins = map[string]bool{
+	"len": true, "upper": true, "lower": true, "int": true,
+	"str": true, "abs": true, "min": true, "max": true,
+}
+
+func isNameByte(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// call evaluates the arguments of the function name, whose opening
+// parenthesis has been consumed, and applies it.
+func (e *evaluator) call(name string) (Value, error) {
+	var args []Value
+	if !e.accept(')') {
+		for {
+			v, err := e.expression()
+			if err != nil {
+				return Value{}, err
+			}
+			args = append(args, v)
+			if e.accept(')') {
+				break
+			}
+			if !e.accept(',') {
+				return Value{}, e.errorf("missing , or )")
+			}
+		}
+	}
+	ints := func() ([]*big.Int, error) {
+		if len(args) == 0 {
+			return nil, e.errorf("%s: want at least one argument", name)
+		}
+		ns := make([]*big.Int, len(args))
+		for i, v := range args {
+			if v.IsStr {
+				return nil, e.errorf("%s: argument %d is a string, want an int", name, i+1)
+			}
+			ns[i] = big.NewInt(int64(v.Int))
+		}
+		return ns, nil
+	}
+	str := func() (string, error) {
+		if len(args) != 1 || !args[0].IsStr {
+			return "", e.errorf("%s: want one string argument", name)
+		}
+		return args[0].Str, nil
+	}
+
+	switch name {
+	case "len":
+		s, err := str()
+		if err != nil {
+			return Value{}, err
+		}
+		return e.checkInt(big.NewInt(int64(e.unit.Len(s))))
+	case "upper", "lower":
+		s, err := str()
+		if err != nil {
+			return Value{}, err
+		}
+		if name == "upper" {
+			return e.checkStr(strings.ToUpper(s))
+		}
+		return e.checkStr(strings.ToLower(s))
+	case "int":
+		s, err := str()
+		if err != nil {
+			return Value{}, err
+		}
+		n, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return Value{}, fmt.Errorf("%w: %q", ErrInvalidNumber, s)
+		}
+		return e.checkInt(n)
+	case "str", "abs":
+		if len(args) != 1 {
+			return Value{}, e.errorf("%s: want one argument, got %d", name, len(args))
+		}
+		ns, err := ints()
+		if err != nil {
+			return Value{}, err
+		}
+		if name == "str" {
+			return e.checkStr(ns[0].String())
+		}
+		return e.checkInt(ns[0].Abs(ns[0]))
+	case "min", "max":
+		ns, err := ints()
+		if err != nil {
+			return Value{}, err
+		}
+		m := ns[0]
+		for _, n := range ns[1:] {
+			if c := n.Cmp(m); name == "min" && c < 0 || name == "max" && c > 0 {
+				m = n
+			}
+		}
+		return e.checkInt(m)
+	default:
+		return Value{}, e.errorf("unknown function %s", name)
+	}
+}
+
+func (e *evaluator) binary(op byte, v, w Value) (Value, error) {
+	if v.IsStr || w.IsStr {
+		if op == '+' && v.IsStr && w.IsStr {
+			return e.checkStr(v.Str + w.Str)
+		}
+		return Value{}, e.errorf("%c on %s and %s", op, v.typeName(), w.typeName())
+	}
+	x, y := big.NewInt(int64(v.Int)), big.NewInt(int64(w.Int))
+	switch op {
+	case '+':
+		x.Add(x, y)
+	case '-':
+		x.Sub(x, y)
+	case '*':
+		x.Mul(x, y)
+	case '/', '%':
+		if y.Sign() == 0 {
+			return Value{}, ErrDivisionByZero
+		}
+		if op == '/' {
+			x.Quo(x, y)
+		} else {
+			x.Rem(x, y)
+		}
+	}
+	return e.checkInt(x)
+}
+
+func (e *evaluator) checkInt(n *big.Int) (Value, error) {
+	if !n.IsInt64() || n.Int64() < e.min || n.Int64() > e.max {
+		return Value{}, ErrIntOverflow
+	}
+	return IntValue(int(n.Int64())), nil
+}
+
+func (e *evaluator) checkStr(s string) (Value, error) {
+	if !utf8.ValidString(s) {
+		return Value{}, ErrInvalidUTF8
+	}
+	if e.unit.Len(s) > e.maxLen {
+		return Value{}, ErrMaxSizeExceeded
+	}
+	return StrValue(s), nil
+}
@@ -0,0 +1,72 @@
+package addservice
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]Value{"x": IntValue(7), "s": StrValue("ab")}
+	for _, tc := range []struct {
+		expr string
+		want Value
+		err  error
+	}{
+		{"1 + 2 * 3", IntValue(7), nil},
+		{"(1 + 2) * 3", IntValue(9), nil},
+		{"10 - 4 - 3", IntValue(3), nil},
+		{"20 / 3 % 4", IntValue(2), nil},
+		{"-x * 2", IntValue(-14), nil},
+		{"- -3", IntValue(3), nil},
+		{"+x", IntValue(7), nil},
+		{"s + upper(s)", StrValue("abAB"), nil},
+		{"len(s) + max(1, x, 3)", IntValue(9), nil},
+		{"int(\"12\") + abs(-3)", IntValue(15), nil},
+		{"2147483647 + 1", Value{}, ErrIntOverflow},
+		{"-2147483647 - 2", Value{}, ErrIntOverflow},
+		{"99999999999999999999", Value{}, ErrIntOverflow},
+		{"x / 0", Value{}, ErrDivisionByZero},
+		{"x % (1 - 1)", Value{}, ErrDivisionByZero},
+		{"s + \"123456789\"", Value{}, ErrMaxSizeExceeded},
+		{"+s", Value{}, ErrInvalidExpression},
+		{"s * 2", Value{}, ErrInvalidExpression},
+		{"1 +", Value{}, ErrInvalidExpression},
+		{"(1", Value{}, ErrInvalidExpression},
+		{"y", Value{}, ErrInvalidExpression},
+		{"f(1)", Value{}, ErrInvalidExpression},
+		{"1 2", Value{}, ErrInvalidExpression},
+	} {
+		t.Run(tc.expr, func(t *testing.T) {
+			v, err := eval(DefaultConfig(), tc.expr, vars)
+			if !errors.Is(err, tc.err) {
+				t.Fatalf("want error %v, have %v", tc.err, err)
+			}
+			if v != tc.want {
+				t.Fatalf("want %v, have %v", tc.want, v)
+			}
+		})
+	}
+}
+
+func TestEvalDepth(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		expr string
+		err  error
+	}{
+		{"parentheses", strings.Repeat("(", maxEvalDepth-1) + "1" + strings.Repeat(")", maxEvalDepth-1), nil},
+		{"too many parentheses", strings.Repeat("(", maxEvalDepth) + "1" + strings.Repeat(")", maxEvalDepth), ErrInvalidExpression},
+		{"signs", strings.Repeat("-", maxEvalDepth-1) + "1", nil},
+		{"too many signs", strings.Repeat("-", maxEvalDepth) + "1", ErrInvalidExpression},
+		{"mixed", strings.Repeat("-(", maxEvalDepth/2) + "1" + strings.Repeat(")", maxEvalDepth/2), ErrInvalidExpression},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.MaxExprLen = 10 * maxEvalDepth
+			if _, err := eval(cfg, tc.expr, nil); !errors.Is(err, tc.err) {
+				t.Fatalf("want error %v, have %v", tc.err, err)
+			}
+		})
+	}
+}
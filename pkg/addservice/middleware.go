@@ -2,8 +2,14 @@ package addservice
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Middleware func(next Service) Service
@@ -32,14 +38,155 @@ func (mw loggingMiddleware) Sum(ctx context.Context, a, b int) (v int, err error
 	return mw.next.Sum(ctx, a, b)
 }
 
-func (mw loggingMiddleware) Concat(ctx context.Context, a, b string) (v string, err error) {
+func (mw loggingMiddleware) Concat(ctx context.Context, a, b string, opts ConcatOptions) (v string, err error) {
 	defer func() {
 		mw.logger.Log("method", "Concat",
 			"a", a,
 			"b", b,
+			"length_unit", opts.LengthUnit,
+			"normalization", opts.Normalization,
 			"v", v,
 			"err", err,
 		)
 	}()
-	return mw.next.Concat(ctx, a, b)
+	return mw.next.Concat(ctx, a, b, opts)
+}
+
+func (mw loggingMiddleware) SumDecimal(ctx context.Context, a, b string, mode Mode) (v string, err error) {
+	defer func() {
+		mw.logger.Log(
+			"method", "SumDecimal",
+			"a", a,
+			"b", b,
+			"mode", mode,
+			"v", v,
+			"err", err,
+		)
+	}()
+	return mw.next.SumDecimal(ctx, a, b, mode)
+}
+
+func (mw loggingMiddleware) Eval(ctx context.Context, expr string, vars map[string]Value) (v Value, err error) {
+	defer func() {
+		mw.logger.Log(
+			"method", "Eval",
+			"expr", expr,
+			"vars", len(vars),
+			"v", v,
+			"err", err,
+		)
+	}()
+	return mw.next.Eval(ctx, expr, vars)
+}
+
+func InstrumentingMiddleware(requests, failures metrics.Counter, duration metrics.Histogram) Middleware {
+	return func(next Service) Service {
+		return instrumentingMiddleware{
+			requests: requests,
+			failures: failures,
+			duration: duration,
+			next:     next,
+		}
+	}
+}
+
+type instrumentingMiddleware struct {
+	requests metrics.Counter
+	failures metrics.Counter
+	duration metrics.Histogram
+	next     Service
+}
+
+func (mw instrumentingMiddleware) Sum(ctx context.Context, a, b int) (v int, err error) {
+	defer func(begin time.Time) {
+		mw.observe("Sum", begin, err)
+	}(time.Now())
+	return mw.next.Sum(ctx, a, b)
+}
+
+func (mw instrumentingMiddleware) Concat(ctx context.Context, a, b string, opts ConcatOptions) (v string, err error) {
+	defer func(begin time.Time) {
+		mw.observe("Concat", begin, err)
+	}(time.Now())
+	return mw.next.Concat(ctx, a, b, opts)
+}
+
+func (mw instrumentingMiddleware) SumDecimal(ctx context.Context, a, b string, mode Mode) (v string, err error) {
+	defer func(begin time.Time) {
+		mw.observe("SumDecimal", begin, err)
+	}(time.Now())
+	return mw.next.SumDecimal(ctx, a, b, mode)
+}
+
+func (mw instrumentingMiddleware) Eval(ctx context.Context, expr string, vars map[string]Value) (v Value, err error) {
+	defer func(begin time.Time) {
+		mw.observe("Eval", begin, err)
+	}(time.Now())
+	return mw.next.Eval(ctx, expr, vars)
+}
+
+func (mw instrumentingMiddleware) observe(method string, begin time.Time, err error) {
+	mw.requests.With("method", method).Add(1)
+	if err != nil {
+		mw.failures.With("method", method, "reason", ErrorReason(err)).Add(1)
+	}
+	mw.duration.With("method", method, "success", fmt.Sprint(err == nil)).Observe(time.Since(begin).Seconds())
+}
+
+func TracingMiddleware(tracer trace.Tracer) Middleware {
+	return func(next Service) Service {
+		return tracingMiddleware{tracer, next}
+	}
+}
+
+type tracingMiddleware struct {
+	tracer trace.Tracer
+	next   Service
+}
+
+func (mw tracingMiddleware) Sum(ctx context.Context, a, b int) (v int, err error) {
+	ctx, span := mw.tracer.Start(ctx, "addservice.Sum", trace.WithAttributes(
+		attribute.Int("a", a),
+		attribute.Int("b", b),
+	))
+	defer func() { endSpan(span, err) }()
+	return mw.next.Sum(ctx, a, b)
+}
+
+func (mw tracingMiddleware) Concat(ctx context.Context, a, b string, opts ConcatOptions) (v string, err error) {
+	ctx, span := mw.tracer.Start(ctx, "addservice.Concat", trace.WithAttributes(
+		attribute.Int("a.len", len(a)),
+		attribute.Int("b.len", len(b)),
+		attribute.String("length_unit", string(opts.LengthUnit)),
+		attribute.String("normalization", string(opts.Normalization)),
+	))
+	defer func() { endSpan(span, err) }()
+	return mw.next.Concat(ctx, a, b, opts)
+}
+
+func (mw tracingMiddleware) SumDecimal(ctx context.Context, a, b string, mode Mode) (v string, err error) {
+	ctx, span := mw.tracer.Start(ctx, "addservice.SumDecimal", trace.WithAttributes(
+		attribute.String("a", a),
+		attribute.String("b", b),
+		attribute.String("mode", string(mode)),
+	))
+	defer func() { endSpan(span, err) }()
+	return mw.next.SumDecimal(ctx, a, b, mode)
+}
+
+func (mw tracingMiddleware) Eval(ctx context.Context, expr string, vars map[string]Value) (v Value, err error) {
+	ctx, span := mw.tracer.Start(ctx, "addservice.Eval", trace.WithAttributes(
+		attribute.String("expr", expr),
+		attribute.Int("vars", len(vars)),
+	))
+	defer func() { endSpan(span, err) }()
+	return mw.next.Eval(ctx, expr, vars)
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, ErrorReason(err))
+	}
+	span.End()
 }
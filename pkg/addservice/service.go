@@ -3,55 +3,254 @@ package addservice
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"unicode/utf8"
 
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Service interface {
 	Sum(ctx context.Context, a, b int) (int, error)
-	Concat(ctx context.Context, a, b string) (string, error)
+	// Concat joins two UTF-8 strings, within Config.MaxLen as measured in
+	// the length unit of opts.
+	Concat(ctx context.Context, a, b string, opts ConcatOptions) (string, error)
+	// SumDecimal adds integers written in decimal, in the given mode or, if
+	// it is empty, in the mode of the deployment.
+	SumDecimal(ctx context.Context, a, b string, mode Mode) (string, error)
+	// Eval evaluates expr with the given variables, see EvalRequest in the
+	// proto definition for the syntax.
+	Eval(ctx context.Context, expr string, vars map[string]Value) (Value, error)
 }
 
-func New(logger log.Logger) Service {
+// Mode tells the range of the operands and results of sums.
+type Mode string
+
+const (
+	// ModeBounded keeps sums within [Config.IntMin, Config.IntMax], 32 bits
+	// by default.
+	ModeBounded Mode = "bounded"
+	// ModeInt64 keeps sums within 64 bits.
+	ModeInt64 Mode = "int64"
+	// ModeBig has no bounds but Config.MaxDigits.
+	ModeBig Mode = "big"
+)
+
+// ParseMode returns the mode named s. The empty string is the empty mode,
+// which stands for the mode of the deployment.
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "", ModeBounded, ModeInt64, ModeBig:
+		return m, nil
+	default:
+		return "", fmt.Errorf("%w %q, want %s, %s or %s", ErrUnknownMode, s, ModeBounded, ModeInt64, ModeBig)
+	}
+}
+
+// New returns the service with its middlewares. The results of Sum and
+// Concat are kept in cache.
+func New(limits *Limits, cache *Cache, logger log.Logger, requests, failures metrics.Counter, duration metrics.Histogram, tracer trace.Tracer) Service {
 	var svc Service
 	{
-		svc = NewBasicService()
+		svc = NewBasicService(limits)
+		svc = CachingMiddleware(cache)(svc)
 		svc = LoggingMiddleware(logger)(svc)
+		svc = InstrumentingMiddleware(requests, failures, duration)(svc)
+		svc = TracingMiddleware(tracer)(svc)
 	}
 	return svc
 }
 
-var (
-	ErrTwoZeroes       = errors.New("can't sum two zeroes")
-	ErrIntOverflow     = errors.New("integer overflow")
-	ErrMaxSizeExceeded = errors.New("result exceeds maximum size")
-)
+// Config holds the limits of the service. Mode is the mode of sums that do
+// not ask for one, and LengthUnit and Normalization the options of
+// concatenations that do not. Eval applies the limits of Sum and Concat to
+// every value of an expression.
+type Config struct {
+	IntMax        int           `yaml:"int_max"`
+	IntMin        int           `yaml:"int_min"`
+	MaxLen        int           `yaml:"max_len"`
+	LengthUnit    LengthUnit    `yaml:"length_unit"`
+	Normalization Normalization `yaml:"normalization"`
+	Mode          Mode          `yaml:"mode"`
+	MaxDigits     int           `yaml:"max_digits"`
+	MaxExprLen    int           `yaml:"max_expr_len"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		IntMax:        1<<31 - 1,
+		IntMin:        -(1 << 31),
+		MaxLen:        10,
+		LengthUnit:    UnitBytes,
+		Normalization: NormalizeNone,
+		Mode:          ModeBounded,
+		MaxDigits:     1000,
+		MaxExprLen:    1000,
+	}
+}
+
+func (c Config) Validate() error {
+	if c.IntMin >= 0 || c.IntMax <= 0 {
+		return errors.New("int_min must be negative and int_max positive")
+	}
+	if c.MaxLen < 0 {
+		return errors.New("max_len must not be negative")
+	}
+	if u, err := ParseLengthUnit(string(c.LengthUnit)); err != nil || u == "" {
+		return fmt.Errorf("length_unit: want %s, %s or %s", UnitBytes, UnitRunes, UnitGraphemes)
+	}
+	if n, err := ParseNormalization(string(c.Normalization)); err != nil || n == "" {
+		return fmt.Errorf("normalization: want %s, %s or %s", NormalizeNone, NormalizeNFC, NormalizeNFKC)
+	}
+	if m, err := ParseMode(string(c.Mode)); err != nil || m == "" {
+		return fmt.Errorf("mode: want %s, %s or %s", ModeBounded, ModeInt64, ModeBig)
+	}
+	if c.MaxDigits < 1 {
+		return errors.New("max_digits must be at least 1")
+	}
+	if c.MaxExprLen < 1 {
+		return errors.New("max_expr_len must be at least 1")
+	}
+	return nil
+}
 
-func NewBasicService() Service {
-	return basicService{}
+// Limits holds the Config in use, which may be replaced while serving.
+type Limits struct {
+	mtx sync.RWMutex
+	cfg Config
 }
 
-type basicService struct{}
+func NewLimits(cfg Config) *Limits {
+	return &Limits{cfg: cfg}
+}
 
-const (
-	intMax = 1<<31 - 1
-	intMin = -(intMax + 1)
-	maxLen = 10
-)
+func (l *Limits) Config() Config {
+	l.mtx.RLock()
+	defer l.mtx.RUnlock()
+	return l.cfg
+}
+
+func (l *Limits) Set(cfg Config) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.cfg = cfg
+}
+
+func NewBasicService(limits *Limits) Service {
+	return basicService{limits}
+}
+
+type basicService struct {
+	limits *Limits
+}
 
 func (s basicService) Sum(_ context.Context, a, b int) (int, error) {
 	if a == 0 && b == 0 {
 		return 0, ErrTwoZeroes
 	}
-	if (b > 0 && a > (intMax-b)) || (b < 0 && a < (intMin-b)) {
+	cfg := s.limits.Config()
+	min, max := cfg.IntMin, cfg.IntMax
+	if cfg.Mode != ModeBounded {
+		// Big sums of ints still have to fit one.
+		min, max = math.MinInt64, math.MaxInt64
+	}
+	if (b > 0 && a > (max-b)) || (b < 0 && a < (min-b)) {
 		return 0, ErrIntOverflow
 	}
 	return a + b, nil
 }
 
-func (s basicService) Concat(_ context.Context, a, b string) (string, error) {
-	if len(a)+len(b) > maxLen {
+func (s basicService) SumDecimal(_ context.Context, a, b string, mode Mode) (string, error) {
+	cfg := s.limits.Config()
+	if mode == "" {
+		mode = cfg.Mode
+	}
+	var min, max *big.Int
+	switch mode {
+	case ModeBounded:
+		min, max = big.NewInt(int64(cfg.IntMin)), big.NewInt(int64(cfg.IntMax))
+	case ModeInt64:
+		min, max = big.NewInt(math.MinInt64), big.NewInt(math.MaxInt64)
+	case ModeBig:
+	default:
+		_, err := ParseMode(string(mode))
+		return "", err
+	}
+	x, ok := parseDecimal(a, cfg.MaxDigits)
+	if !ok {
+		return "", fmt.Errorf("%w: a: %q", ErrInvalidNumber, a)
+	}
+	y, ok := parseDecimal(b, cfg.MaxDigits)
+	if !ok {
+		return "", fmt.Errorf("%w: b: %q", ErrInvalidNumber, b)
+	}
+	if x.Sign() == 0 && y.Sign() == 0 {
+		return "", ErrTwoZeroes
+	}
+	inRange := func(v *big.Int) bool {
+		return min == nil || v.Cmp(min) >= 0 && v.Cmp(max) <= 0
+	}
+	if !inRange(x) || !inRange(y) {
+		return "", ErrIntOverflow
+	}
+	v := new(big.Int).Add(x, y)
+	if !inRange(v) || len(new(big.Int).Abs(v).Text(10)) > cfg.MaxDigits {
+		return "", ErrIntOverflow
+	}
+	return v.String(), nil
+}
+
+// parseDecimal reads an optionally signed decimal integer of at most
+// maxDigits digits.
+func parseDecimal(s string, maxDigits int) (*big.Int, bool) {
+	digits := strings.TrimLeft(s, "+-")
+	if len(s)-len(digits) > 1 || digits == "" || len(digits) > maxDigits {
+		return nil, false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return nil, false
+		}
+	}
+	return new(big.Int).SetString(s, 10)
+}
+
+func (s basicService) Eval(_ context.Context, expr string, vars map[string]Value) (Value, error) {
+	return eval(s.limits.Config(), expr, vars)
+}
+
+func (s basicService) Concat(_ context.Context, a, b string, opts ConcatOptions) (string, error) {
+	cfg := s.limits.Config()
+	if opts.LengthUnit == "" {
+		opts.LengthUnit = cfg.LengthUnit
+	}
+	if opts.Normalization == "" {
+		opts.Normalization = cfg.Normalization
+	}
+	unit, err := ParseLengthUnit(string(opts.LengthUnit))
+	if err != nil {
+		return "", err
+	}
+	form, err := ParseNormalization(string(opts.Normalization))
+	if err != nil {
+		return "", err
+	}
+	if !utf8.ValidString(a) {
+		return "", fmt.Errorf("%w: a", ErrInvalidUTF8)
+	}
+	if !utf8.ValidString(b) {
+		return "", fmt.Errorf("%w: b", ErrInvalidUTF8)
+	}
+	// Joining may compose characters across the boundary, so the result is
+	// normalized and measured as a whole.
+	v := form.apply(a + b)
+	if unit.Len(v) > cfg.MaxLen {
 		return "", ErrMaxSizeExceeded
 	}
-	return a + b, nil
+	return v, nil
 }
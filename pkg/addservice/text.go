@@ -0,0 +1,82 @@
+package addservice
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rivo/uniseg"
+	"golang.org/x/text/unicode/norm"
+)
+
+// LengthUnit tells how the length of strings is measured against
+// Config.MaxLen.
+type LengthUnit string
+
+const (
+	UnitBytes     LengthUnit = "bytes"
+	UnitRunes     LengthUnit = "runes"
+	UnitGraphemes LengthUnit = "graphemes"
+)
+
+// ParseLengthUnit returns the unit named s. The empty string stands for the
+// unit of the deployment.
+func ParseLengthUnit(s string) (LengthUnit, error) {
+	switch u := LengthUnit(strings.ToLower(s)); u {
+	case "", UnitBytes, UnitRunes, UnitGraphemes:
+		return u, nil
+	default:
+		return "", fmt.Errorf("%w: length unit %q, want %s, %s or %s", ErrUnknownOption, s, UnitBytes, UnitRunes, UnitGraphemes)
+	}
+}
+
+// Len returns the length of s in unit u.
+func (u LengthUnit) Len(s string) int {
+	switch u {
+	case UnitRunes:
+		return utf8.RuneCountInString(s)
+	case UnitGraphemes:
+		return uniseg.GraphemeClusterCount(s)
+	default:
+		return len(s)
+	}
+}
+
+// Normalization is the Unicode normalization form applied to the result of
+// Concat.
+type Normalization string
+
+const (
+	NormalizeNone Normalization = "none"
+	NormalizeNFC  Normalization = "nfc"
+	NormalizeNFKC Normalization = "nfkc"
+)
+
+// ParseNormalization returns the form named s, in any case. The empty
+// string stands for the form of the deployment.
+func ParseNormalization(s string) (Normalization, error) {
+	switch n := Normalization(strings.ToLower(s)); n {
+	case "", NormalizeNone, NormalizeNFC, NormalizeNFKC:
+		return n, nil
+	default:
+		return "", fmt.Errorf("%w: normalization %q, want %s, %s or %s", ErrUnknownOption, s, NormalizeNone, NormalizeNFC, NormalizeNFKC)
+	}
+}
+
+func (n Normalization) apply(s string) string {
+	switch n {
+	case NormalizeNFC:
+		return norm.NFC.String(s)
+	case NormalizeNFKC:
+		return norm.NFKC.String(s)
+	default:
+		return s
+	}
+}
+
+// ConcatOptions override the Config of the deployment for a single Concat.
+// Empty fields keep it.
+type ConcatOptions struct {
+	LengthUnit    LengthUnit
+	Normalization Normalization
+}
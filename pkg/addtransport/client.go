@@ -0,0 +1,78 @@
+package addtransport
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/circuitbreaker"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/sony/gobreaker"
+)
+
+// ClientConfig tunes the resilience middlewares of the clients: a rate limit
+// shared by all methods of one instance, and how long a tripped circuit
+// breaker stays open per method, with BreakerTimeout for methods without a
+// setting of their own, unless DisableBreakers leaves failures to the caller.
+// Encoding is the body encoding of the HTTP client, one of Encodings().
+type ClientConfig struct {
+	RateLimit            addendpoint.RateLimit `yaml:"rate_limit"`
+	BreakerTimeout       time.Duration         `yaml:"breaker_timeout"`
+	SumBreakerTimeout    time.Duration         `yaml:"sum_breaker_timeout"`
+	ConcatBreakerTimeout time.Duration         `yaml:"concat_breaker_timeout"`
+	DisableBreakers      bool                  `yaml:"disable_breakers"`
+	Encoding             string                `yaml:"encoding"`
+}
+
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		RateLimit:            addendpoint.RateLimit{Rate: 1, Burst: 100},
+		BreakerTimeout:       30 * time.Second,
+		SumBreakerTimeout:    30 * time.Second,
+		ConcatBreakerTimeout: 10 * time.Second,
+		Encoding:             "json",
+	}
+}
+
+func (c ClientConfig) Validate() error {
+	if err := c.RateLimit.Validate(); err != nil {
+		return fmt.Errorf("rate_limit: %w", err)
+	}
+	if c.BreakerTimeout <= 0 || c.SumBreakerTimeout <= 0 || c.ConcatBreakerTimeout <= 0 {
+		return errors.New("breaker timeouts must be positive")
+	}
+	if _, err := clientCodec(c.Encoding); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c ClientConfig) breakerTimeout(method string) time.Duration {
+	switch method {
+	case "Sum":
+		return c.SumBreakerTimeout
+	case "Concat":
+		return c.ConcatBreakerTimeout
+	default:
+		return c.BreakerTimeout
+	}
+}
+
+func (c ClientConfig) circuitBreaker(method string, stateChanges metrics.Counter) endpoint.Middleware {
+	if c.DisableBreakers {
+		return func(next endpoint.Endpoint) endpoint.Endpoint { return next }
+	}
+	return newCircuitBreaker(method, c.breakerTimeout(method), stateChanges)
+}
+
+func newCircuitBreaker(name string, timeout time.Duration, stateChanges metrics.Counter) endpoint.Middleware {
+	return circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
+		Name:    name,
+		Timeout: timeout,
+		OnStateChange: func(name string, from, to gobreaker.State) {
+			stateChanges.With("name", name, "from", from.String(), "to", to.String()).Add(1)
+		},
+	}))
+}
@@ -0,0 +1,615 @@
+package addtransport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/maolonglong/microservices-example/pb"
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// A codec encodes the request, response and error bodies of the HTTP API in
+// one media type. Strict decoding, used for requests, rejects unknown and
+// missing fields where the format allows telling.
+type codec struct {
+	name      string
+	mediaType string
+	marshal   func(v interface{}) ([]byte, error)
+	unmarshal func(data []byte, v interface{}, strict bool) error
+}
+
+const (
+	mediaTypeJSON     = "application/json"
+	mediaTypeProtobuf = "application/x-protobuf"
+	mediaTypeMsgpack  = "application/msgpack"
+	mediaTypeForm     = "application/x-www-form-urlencoded"
+)
+
+var codecs = []codec{
+	{"json", mediaTypeJSON, marshalJSON, unmarshalJSON},
+	{"protobuf", mediaTypeProtobuf, marshalProtobuf, unmarshalProtobuf},
+	{"msgpack", mediaTypeMsgpack, marshalMsgpack, unmarshalMsgpack},
+	{"form", mediaTypeForm, marshalForm, unmarshalForm},
+}
+
+func (c codec) contentType() string {
+	if c.mediaType == mediaTypeJSON {
+		return c.mediaType + "; charset=utf-8"
+	}
+	return c.mediaType
+}
+
+// encodes tells whether c can encode values of type t. Forms only hold flat
+// messages with scalar fields.
+func (c codec) encodes(t reflect.Type) bool {
+	return c.mediaType != mediaTypeForm || formEncodable(t)
+}
+
+// httpClientRequests are the requests NewHTTPClient sends, which its
+// encoding must be able to encode.
+var httpClientRequests = []reflect.Type{
+	reflect.TypeOf(addendpoint.SumRequest{}),
+	reflect.TypeOf(addendpoint.ConcatRequest{}),
+	reflect.TypeOf(addendpoint.SumDecimalRequest{}),
+	reflect.TypeOf(addendpoint.EvalRequest{}),
+}
+
+func clientCodec(name string) (codec, error) {
+	c, ok := codecByName(name)
+	switch {
+	case !ok:
+		return codec{}, fmt.Errorf("unknown encoding %q, want one of %s", name, strings.Join(Encodings(), ", "))
+	case !c.encodesClientRequests():
+		return codec{}, fmt.Errorf("encoding %s cannot hold every request of the client, want one of %s", name, strings.Join(Encodings(), ", "))
+	}
+	return c, nil
+}
+
+func (c codec) encodesClientRequests() bool {
+	for _, t := range httpClientRequests {
+		if !c.encodes(t) {
+			return false
+		}
+	}
+	return true
+}
+
+// Encodings returns the names NewHTTPClient accepts as encoding.
+func Encodings() []string {
+	var names []string
+	for _, c := range codecs {
+		if c.encodesClientRequests() {
+			names = append(names, c.name)
+		}
+	}
+	return names
+}
+
+func codecByName(name string) (codec, bool) {
+	for _, c := range codecs {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return codec{}, false
+}
+
+func codecByMediaType(mediaType string) (codec, bool) {
+	for _, c := range codecs {
+		if c.mediaType == mediaType {
+			return c, true
+		}
+	}
+	// Common aliases.
+	switch mediaType {
+	case "application/protobuf", "application/vnd.google.protobuf":
+		return codecs[1], true
+	case "application/x-msgpack":
+		return codecs[2], true
+	}
+	return codec{}, false
+}
+
+// contentCodec picks the codec for the body of r from its Content-Type,
+// which defaults to JSON.
+func contentCodec(header http.Header) (codec, error) {
+	ct := header.Get("Content-Type")
+	if ct == "" {
+		return codecs[0], nil
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return codec{}, fmt.Errorf("%w: %v", ErrUnsupportedMediaType, err)
+	}
+	c, ok := codecByMediaType(mediaType)
+	if !ok {
+		return codec{}, fmt.Errorf("%w: %s", ErrUnsupportedMediaType, mediaType)
+	}
+	return c, nil
+}
+
+// acceptCodec picks the codec the client prefers according to its Accept
+// header. Clients without a supported preference get JSON.
+func acceptCodec(header http.Header) codec {
+	type candidate struct {
+		c codec
+		q float64
+	}
+	var candidates []candidate
+	for _, part := range strings.Split(header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if s, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(s, 64); err != nil {
+				continue
+			}
+		}
+		if c, ok := codecByMediaType(mediaType); ok && q > 0 {
+			candidates = append(candidates, candidate{c, q})
+		}
+	}
+	if len(candidates) == 0 {
+		return codecs[0]
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].q > candidates[j].q })
+	return candidates[0].c
+}
+
+func marshalJSON(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func unmarshalJSON(data []byte, v interface{}, strict bool) error {
+	if !strict {
+		return json.Unmarshal(data, v)
+	}
+	// encoding/json would replace invalid UTF-8 with U+FFFD, so requests are
+	// rejected the way the other codecs let the service do.
+	if !utf8.Valid(data) {
+		return addservice.ErrInvalidUTF8
+	}
+	var body interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the JSON object")
+	}
+	if err := checkValue(body, reflect.TypeOf(v).Elem(), ""); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func marshalMsgpack(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	err := enc.Encode(v)
+	return buf.Bytes(), err
+}
+
+func unmarshalMsgpack(data []byte, v interface{}, strict bool) error {
+	if strict {
+		var body interface{}
+		if err := msgpack.Unmarshal(data, &body); err != nil {
+			return err
+		}
+		if err := checkValue(body, reflect.TypeOf(v).Elem(), ""); err != nil {
+			return err
+		}
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func marshalForm(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	if !formEncodable(rv.Type()) {
+		return nil, fmt.Errorf("%T cannot be encoded as a form", v)
+	}
+	values := url.Values{}
+	for _, f := range jsonFields(rv.Type()) {
+		fv := rv.Field(f.index)
+		if f.omitEmpty && fv.IsZero() {
+			continue
+		}
+		values.Set(f.name, fmt.Sprint(fv.Interface()))
+	}
+	return []byte(values.Encode()), nil
+}
+
+func unmarshalForm(data []byte, v interface{}, strict bool) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	return decodeValues(values, v, strict)
+}
+
+// formEncodable tells whether t is a struct whose fields all fit in a form
+// value, as decodeValues expects.
+func formEncodable(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	for _, f := range jsonFields(t) {
+		switch f.typ.Kind() {
+		case reflect.String, reflect.Int, reflect.Int64, reflect.Bool:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// decodeValues sets the fields of the struct v points to from values, keyed
+// by their JSON names. Strict decoding expects every field exactly once and
+// nothing else.
+func decodeValues(values url.Values, v interface{}, strict bool) error {
+	rv := reflect.ValueOf(v).Elem()
+	if strict {
+		var names []string
+		for name, vs := range values {
+			if len(vs) > 1 {
+				return fmt.Errorf("%s given more than once", name)
+			}
+			names = append(names, name)
+		}
+		if err := checkFields(names, rv.Type()); err != nil {
+			return err
+		}
+	}
+	for _, f := range jsonFields(rv.Type()) {
+		s, ok := values[f.name]
+		if !ok {
+			continue
+		}
+		fv := rv.Field(f.index)
+		switch fv.Kind() {
+		case reflect.String:
+			fv.SetString(s[0])
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(s[0], 10, 64)
+			if err != nil || fv.OverflowInt(n) {
+				return fmt.Errorf("%s: not an integer: %q", f.name, s[0])
+			}
+			fv.SetInt(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(s[0])
+			if err != nil {
+				return fmt.Errorf("%s: not a boolean: %q", f.name, s[0])
+			}
+			fv.SetBool(b)
+		default:
+			return fmt.Errorf("%s: unsupported type %s", f.name, fv.Type())
+		}
+	}
+	return nil
+}
+
+// checkFields compares the field names found in a body with those of t.
+func checkFields(names []string, t reflect.Type) error {
+	present := map[string]bool{}
+	for _, name := range names {
+		present[name] = true
+	}
+	for _, f := range jsonFields(t) {
+		if !present[f.name] && !f.omitEmpty {
+			return fmt.Errorf("%s is required", f.name)
+		}
+		delete(present, f.name)
+	}
+	for name := range present {
+		return fmt.Errorf("unknown field %q", name)
+	}
+	return nil
+}
+
+// checkValue runs checkFields on v, a body decoded without a target type,
+// and on every message nested in it. path locates v in the body.
+func checkValue(v interface{}, t reflect.Type, path string) error {
+	switch t.Kind() {
+	case reflect.Ptr:
+		if v == nil {
+			return nil
+		}
+		return checkValue(v, t.Elem(), path)
+	case reflect.Struct:
+		fields, ok := v.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%sexpected an object", pathPrefix(path))
+		}
+		var names []string
+		for name := range fields {
+			names = append(names, name)
+		}
+		if err := checkFields(names, t); err != nil {
+			return fmt.Errorf("%s%w", pathPrefix(path), err)
+		}
+		for _, f := range jsonFields(t) {
+			if fv, ok := fields[f.name]; ok {
+				if err := checkValue(fv, f.typ, joinPath(path, f.name)); err != nil {
+					return err
+				}
+			}
+		}
+	case reflect.Slice:
+		items, _ := v.([]interface{})
+		for i, item := range items {
+			if err := checkValue(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		entries, _ := v.(map[string]interface{})
+		for k, entry := range entries {
+			if err := checkValue(entry, t.Elem(), joinPath(path, k)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func pathPrefix(path string) string {
+	if path == "" {
+		return ""
+	}
+	return path + ": "
+}
+
+// The protobuf encoding reuses the gRPC messages, and google.rpc.Status
+// with an ErrorInfo detail for errors, like the gRPC transport.
+
+func marshalProtobuf(v interface{}) ([]byte, error) {
+	var m proto.Message
+	switch v := v.(type) {
+	case addendpoint.SumRequest:
+		m = &pb.SumRequest{A: int64(v.A), B: int64(v.B), Mode: v.Mode}
+	case addendpoint.SumResponse:
+		m = &pb.SumResponse{V: int64(v.V)}
+	case addendpoint.SumDecimalRequest:
+		m = &pb.SumDecimalRequest{A: v.A, B: v.B, Mode: v.Mode}
+	case addendpoint.SumDecimalResponse:
+		m = &pb.SumDecimalResponse{V: v.V}
+	case addendpoint.EvalRequest:
+		m = &pb.EvalRequest{Expr: v.Expr, Vars: encodeGRPCVars(v.Vars)}
+	case addendpoint.EvalResponse:
+		m = &pb.EvalResponse{V: encodeGRPCValue(v.V)}
+	case addendpoint.ConcatRequest:
+		m = &pb.ConcatRequest{A: v.A, B: v.B, LengthUnit: v.LengthUnit, Normalization: v.Normalization}
+	case addendpoint.ConcatResponse:
+		m = &pb.ConcatResponse{V: v.V}
+	case addendpoint.BatchSumRequest:
+		items := make([]*pb.SumRequest, len(v.Items))
+		for i, item := range v.Items {
+			items[i] = &pb.SumRequest{A: int64(item.A), B: int64(item.B), Mode: item.Mode}
+		}
+		m = &pb.BatchSumRequest{Items: items}
+	case addendpoint.BatchRequest:
+		ops := make([]*pb.Operation, len(v.Operations))
+		for i, op := range v.Operations {
+			ops[i] = &pb.Operation{}
+			switch {
+			case op.Sum != nil:
+				ops[i].Method = &pb.Operation_Sum{Sum: &pb.SumRequest{A: int64(op.Sum.A), B: int64(op.Sum.B), Mode: op.Sum.Mode}}
+			case op.Concat != nil:
+				ops[i].Method = &pb.Operation_Concat{Concat: &pb.ConcatRequest{
+					A:             op.Concat.A,
+					B:             op.Concat.B,
+					LengthUnit:    op.Concat.LengthUnit,
+					Normalization: op.Concat.Normalization,
+				}}
+			case op.SumDecimal != nil:
+				ops[i].Method = &pb.Operation_SumDecimal{SumDecimal: &pb.SumDecimalRequest{A: op.SumDecimal.A, B: op.SumDecimal.B, Mode: op.SumDecimal.Mode}}
+			case op.Eval != nil:
+				ops[i].Method = &pb.Operation_Eval{Eval: &pb.EvalRequest{Expr: op.Eval.Expr, Vars: encodeGRPCVars(op.Eval.Vars)}}
+			}
+		}
+		m = &pb.BatchRequest{Operations: ops}
+	case batchSumResult:
+		results := make([]*pb.SumResult, len(v.Results))
+		for i, result := range v.Results {
+			results[i] = &pb.SumResult{V: int64(result.V)}
+			if result.Error != "" {
+				results[i].Error = proto.String(result.Error)
+			}
+			if result.Reason != "" {
+				results[i].Reason = proto.String(result.Reason)
+			}
+		}
+		m = &pb.BatchSumResponse{Results: results}
+	case batchResult:
+		results := make([]*pb.OperationResult, len(v.Results))
+		for i, result := range v.Results {
+			results[i] = &pb.OperationResult{}
+			switch {
+			case result.Sum != nil:
+				results[i].Method = &pb.OperationResult_Sum{Sum: &pb.SumResponse{V: int64(result.Sum.V)}}
+			case result.Concat != nil:
+				results[i].Method = &pb.OperationResult_Concat{Concat: &pb.ConcatResponse{V: result.Concat.V}}
+			case result.SumDecimal != nil:
+				results[i].Method = &pb.OperationResult_SumDecimal{SumDecimal: &pb.SumDecimalResponse{V: result.SumDecimal.V}}
+			case result.Eval != nil:
+				results[i].Method = &pb.OperationResult_Eval{Eval: &pb.EvalResponse{V: encodeGRPCValue(result.Eval.V)}}
+			}
+			if result.Error != "" {
+				results[i].Error = proto.String(result.Error)
+			}
+			if result.Reason != "" {
+				results[i].Reason = proto.String(result.Reason)
+			}
+		}
+		m = &pb.BatchResponse{Results: results}
+	case errorWrapper:
+		code := codes.Unknown
+		if spec, ok := addservice.LookupReason(v.Reason); ok {
+			code = spec.GRPCCode
+		}
+		st := status.New(code, v.Error)
+		if v.Reason != "" {
+			info := &errdetails.ErrorInfo{Reason: v.Reason, Domain: errorDomain}
+			if v.Retryable {
+				info.Metadata = map[string]string{"retryable": "true"}
+			}
+			if withDetails, err := st.WithDetails(info); err == nil {
+				st = withDetails
+			}
+		}
+		m = st.Proto()
+	default:
+		return nil, fmt.Errorf("no protobuf message for %T", v)
+	}
+	return proto.Marshal(m)
+}
+
+func unmarshalProtobuf(data []byte, v interface{}, strict bool) error {
+	unmarshal := func(m proto.Message) error {
+		if err := proto.Unmarshal(data, m); err != nil {
+			return err
+		}
+		if strict && len(m.ProtoReflect().GetUnknown()) > 0 {
+			return errors.New("unknown fields in protobuf message")
+		}
+		return nil
+	}
+	switch v := v.(type) {
+	case *addendpoint.SumRequest:
+		var m pb.SumRequest
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		*v = addendpoint.SumRequest{A: int(m.A), B: int(m.B), Mode: m.Mode}
+	case *addendpoint.SumResponse:
+		var m pb.SumResponse
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		*v = addendpoint.SumResponse{V: int(m.V)}
+	case *addendpoint.SumDecimalRequest:
+		var m pb.SumDecimalRequest
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		*v = addendpoint.SumDecimalRequest{A: m.A, B: m.B, Mode: m.Mode}
+	case *addendpoint.SumDecimalResponse:
+		var m pb.SumDecimalResponse
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		*v = addendpoint.SumDecimalResponse{V: m.V}
+	case *addendpoint.EvalRequest:
+		var m pb.EvalRequest
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		vars, err := decodeGRPCVars(m.Vars)
+		if err != nil {
+			return err
+		}
+		*v = addendpoint.EvalRequest{Expr: m.Expr, Vars: vars}
+	case *addendpoint.EvalResponse:
+		var m pb.EvalResponse
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		value, _ := decodeGRPCValue(m.V)
+		*v = addendpoint.EvalResponse{V: value}
+	case *addendpoint.ConcatRequest:
+		var m pb.ConcatRequest
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		*v = addendpoint.ConcatRequest{A: m.A, B: m.B, LengthUnit: m.LengthUnit, Normalization: m.Normalization}
+	case *addendpoint.ConcatResponse:
+		var m pb.ConcatResponse
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		*v = addendpoint.ConcatResponse{V: m.V}
+	case *addendpoint.BatchSumRequest:
+		var m pb.BatchSumRequest
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		items := make([]addendpoint.SumRequest, len(m.Items))
+		for i, item := range m.Items {
+			items[i] = addendpoint.SumRequest{A: int(item.A), B: int(item.B), Mode: item.Mode}
+		}
+		*v = addendpoint.BatchSumRequest{Items: items}
+	case *addendpoint.BatchRequest:
+		var m pb.BatchRequest
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		ops := make([]addendpoint.Operation, len(m.Operations))
+		for i, op := range m.Operations {
+			switch method := op.Method.(type) {
+			case *pb.Operation_Sum:
+				ops[i].Sum = &addendpoint.SumRequest{A: int(method.Sum.A), B: int(method.Sum.B), Mode: method.Sum.Mode}
+			case *pb.Operation_Concat:
+				ops[i].Concat = &addendpoint.ConcatRequest{
+					A:             method.Concat.A,
+					B:             method.Concat.B,
+					LengthUnit:    method.Concat.LengthUnit,
+					Normalization: method.Concat.Normalization,
+				}
+			case *pb.Operation_SumDecimal:
+				ops[i].SumDecimal = &addendpoint.SumDecimalRequest{A: method.SumDecimal.A, B: method.SumDecimal.B, Mode: method.SumDecimal.Mode}
+			case *pb.Operation_Eval:
+				vars, err := decodeGRPCVars(method.Eval.Vars)
+				if err != nil {
+					return fmt.Errorf("operations[%d].eval: %w", i, err)
+				}
+				ops[i].Eval = &addendpoint.EvalRequest{Expr: method.Eval.Expr, Vars: vars}
+			}
+		}
+		*v = addendpoint.BatchRequest{Operations: ops}
+	case *errorWrapper:
+		var m spb.Status
+		if err := unmarshal(&m); err != nil {
+			return err
+		}
+		*v = errorWrapper{Error: m.Message}
+		for _, detail := range status.FromProto(&m).Details() {
+			if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == errorDomain {
+				v.Reason = info.Reason
+				v.Retryable = info.Metadata["retryable"] == "true"
+			}
+		}
+	default:
+		return fmt.Errorf("no protobuf message for %T", v)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package addtransport
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	x, s := 3, "ab"
+	values := []interface{}{
+		addendpoint.SumRequest{A: 1, B: -2, Mode: "saturate"},
+		addendpoint.SumResponse{V: 42},
+		addendpoint.SumDecimalRequest{A: "12", B: "30"},
+		addendpoint.SumDecimalResponse{V: "42"},
+		addendpoint.ConcatRequest{A: "a", B: "é", LengthUnit: "runes"},
+		addendpoint.ConcatResponse{V: "aé"},
+		addendpoint.EvalRequest{Expr: "x + 1", Vars: map[string]addendpoint.Value{"x": {Int: &x}, "s": {Str: &s}}},
+		addendpoint.EvalResponse{V: addendpoint.Value{Str: &s}},
+		addendpoint.BatchSumRequest{Items: []addendpoint.SumRequest{{A: 1, B: 2}, {A: 3, B: 4}}},
+		addendpoint.BatchRequest{Operations: []addendpoint.Operation{
+			{Sum: &addendpoint.SumRequest{A: 1, B: 2}},
+			{Concat: &addendpoint.ConcatRequest{A: "a", B: "b"}},
+			{SumDecimal: &addendpoint.SumDecimalRequest{A: "1", B: "2"}},
+			{Eval: &addendpoint.EvalRequest{Expr: "x", Vars: map[string]addendpoint.Value{"x": {Int: &x}}}},
+		}},
+		errorWrapper{Error: "can't sum two zeroes", Reason: "TWO_ZEROES"},
+	}
+	for _, c := range codecs {
+		for _, v := range values {
+			t.Run(c.name+"/"+reflect.TypeOf(v).Name(), func(t *testing.T) {
+				data, err := c.marshal(v)
+				if !c.encodes(reflect.TypeOf(v)) {
+					if err == nil {
+						t.Fatalf("%s encoded %T", c.name, v)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := reflect.New(reflect.TypeOf(v))
+				if err := c.unmarshal(data, got.Interface(), true); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(got.Elem().Interface(), v) {
+					t.Fatalf("want %+v, have %+v", v, got.Elem().Interface())
+				}
+			})
+		}
+	}
+}
+
+func TestClientCodec(t *testing.T) {
+	for _, name := range []string{"json", "protobuf", "msgpack"} {
+		if _, err := clientCodec(name); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	for _, name := range []string{"form", "xml"} {
+		if _, err := clientCodec(name); err == nil {
+			t.Errorf("%s: want an error", name)
+		}
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		body map[string]interface{}
+		v    interface{}
+		err  string
+	}{
+		{"sum", map[string]interface{}{"a": 1, "b": 2}, &addendpoint.SumRequest{}, ""},
+		{"missing field", map[string]interface{}{"a": 1}, &addendpoint.SumRequest{}, "b is required"},
+		{"unknown field", map[string]interface{}{"a": 1, "b": 2, "c": 3}, &addendpoint.SumRequest{}, `unknown field "c"`},
+		{
+			"batch item",
+			map[string]interface{}{"items": []interface{}{
+				map[string]interface{}{"a": 1, "b": 2},
+				map[string]interface{}{"a": 1, "b": 2, "c": 3},
+			}},
+			&addendpoint.BatchSumRequest{},
+			`items[1]: unknown field "c"`,
+		},
+		{
+			"batch item missing field",
+			map[string]interface{}{"items": []interface{}{map[string]interface{}{"a": 1}}},
+			&addendpoint.BatchSumRequest{},
+			"items[0]: b is required",
+		},
+		{
+			"operation",
+			map[string]interface{}{"operations": []interface{}{
+				map[string]interface{}{"concat": map[string]interface{}{"a": "x", "b": "y", "unit": "bytes"}},
+			}},
+			&addendpoint.BatchRequest{},
+			`operations[0].concat: unknown field "unit"`,
+		},
+		{
+			"eval var",
+			map[string]interface{}{"expr": "x", "vars": map[string]interface{}{
+				"x": map[string]interface{}{"float": 1.5},
+			}},
+			&addendpoint.EvalRequest{},
+			`vars.x: unknown field "float"`,
+		},
+		{
+			"not an object",
+			map[string]interface{}{"items": []interface{}{1}},
+			&addendpoint.BatchSumRequest{},
+			"items[0]: expected an object",
+		},
+	} {
+		for _, name := range []string{"json", "msgpack"} {
+			t.Run(tc.name+"/"+name, func(t *testing.T) {
+				c, _ := codecByName(name)
+				data, err := c.marshal(tc.body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = c.unmarshal(data, tc.v, true)
+				switch {
+				case tc.err == "" && err != nil:
+					t.Fatalf("unexpected error: %v", err)
+				case tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)):
+					t.Fatalf("want error %q, have %v", tc.err, err)
+				}
+			})
+		}
+	}
+}
+
+func TestJSONInvalidUTF8(t *testing.T) {
+	var req addendpoint.ConcatRequest
+	err := unmarshalJSON([]byte("{\"a\":\"\xff\",\"b\":\"x\"}"), &req, true)
+	if !errors.Is(err, addservice.ErrInvalidUTF8) {
+		t.Fatalf("want %v, have %v", addservice.ErrInvalidUTF8, err)
+	}
+}
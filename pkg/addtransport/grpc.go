@@ -3,30 +3,55 @@ package addtransport
 import (
 	"context"
 	"errors"
-	"time"
+	"fmt"
 
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/transport"
 	grpctransport "github.com/go-kit/kit/transport/grpc"
 	"github.com/maolonglong/microservices-example/pb"
 	"github.com/maolonglong/microservices-example/pkg/addendpoint"
 	"github.com/maolonglong/microservices-example/pkg/addservice"
-	"github.com/sony/gobreaker"
-	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Clients that understand gRPC status errors announce it with this metadata
+// key. Everyone else still gets the legacy err field in the response message.
+const (
+	errorModeKey    = "x-addsvc-error-mode"
+	errorModeStatus = "status"
+	errorDomain     = "addsvc"
+)
+
+type contextKey int
+
+const (
+	errorModeContextKey contextKey = iota
+	responseCodecContextKey
 )
 
 type grpcServer struct {
-	sum    grpctransport.Handler
-	concat grpctransport.Handler
+	sum          grpctransport.Handler
+	concat       grpctransport.Handler
+	sumDecimal   grpctransport.Handler
+	eval         grpctransport.Handler
+	batchSum     grpctransport.Handler
+	sumStream    endpoint.Endpoint
+	batch        grpctransport.Handler
+	errorHandler transport.ErrorHandler
 }
 
 func NewGRPCServer(endpoints addendpoint.Set, logger log.Logger) pb.AddServiceServer {
+	errorHandler := transport.NewLogErrorHandler(logger)
 	options := []grpctransport.ServerOption{
-		grpctransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		grpctransport.ServerBefore(extractErrorMode, grpcToContext),
+		grpctransport.ServerErrorHandler(errorHandler),
 	}
 
 	return &grpcServer{
@@ -42,13 +67,39 @@ func NewGRPCServer(endpoints addendpoint.Set, logger log.Logger) pb.AddServiceSe
 			encodeGRPCConcatResponse,
 			options...,
 		),
+		sumDecimal: grpctransport.NewServer(
+			endpoints.SumDecimalEndpoint,
+			decodeGRPCSumDecimalRequest,
+			encodeGRPCSumDecimalResponse,
+			options...,
+		),
+		eval: grpctransport.NewServer(
+			endpoints.EvalEndpoint,
+			decodeGRPCEvalRequest,
+			encodeGRPCEvalResponse,
+			options...,
+		),
+		batchSum: grpctransport.NewServer(
+			endpoints.BatchSumEndpoint,
+			decodeGRPCBatchSumRequest,
+			encodeGRPCBatchSumResponse,
+			options...,
+		),
+		sumStream: endpoints.SumStreamEndpoint,
+		batch: grpctransport.NewServer(
+			endpoints.BatchEndpoint,
+			decodeGRPCBatchRequest,
+			encodeGRPCBatchResponse,
+			options...,
+		),
+		errorHandler: errorHandler,
 	}
 }
 
 func (s *grpcServer) Sum(ctx context.Context, req *pb.SumRequest) (*pb.SumResponse, error) {
 	_, resp, err := s.sum.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, err2status(err)
 	}
 	return resp.(*pb.SumResponse), nil
 }
@@ -56,13 +107,71 @@ func (s *grpcServer) Sum(ctx context.Context, req *pb.SumRequest) (*pb.SumRespon
 func (s *grpcServer) Concat(ctx context.Context, req *pb.ConcatRequest) (*pb.ConcatResponse, error) {
 	_, resp, err := s.concat.ServeGRPC(ctx, req)
 	if err != nil {
-		return nil, err
+		return nil, err2status(err)
 	}
 	return resp.(*pb.ConcatResponse), nil
 }
 
-func NewGRPCClient(conn *grpc.ClientConn, logger log.Logger) addservice.Service {
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
+func (s *grpcServer) SumDecimal(ctx context.Context, req *pb.SumDecimalRequest) (*pb.SumDecimalResponse, error) {
+	_, resp, err := s.sumDecimal.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err2status(err)
+	}
+	return resp.(*pb.SumDecimalResponse), nil
+}
+
+func (s *grpcServer) Eval(ctx context.Context, req *pb.EvalRequest) (*pb.EvalResponse, error) {
+	_, resp, err := s.eval.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err2status(err)
+	}
+	return resp.(*pb.EvalResponse), nil
+}
+
+func (s *grpcServer) BatchSum(ctx context.Context, req *pb.BatchSumRequest) (*pb.BatchSumResponse, error) {
+	_, resp, err := s.batchSum.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err2status(err)
+	}
+	return resp.(*pb.BatchSumResponse), nil
+}
+
+// SumStream is served without a grpctransport.Handler, which only knows
+// unary calls, but takes the same steps.
+func (s *grpcServer) SumStream(stream pb.AddService_SumStreamServer) error {
+	ctx := stream.Context()
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		ctx = grpcToContext(ctx, md)
+	}
+	_, err := s.sumStream(ctx, addendpoint.Stream{
+		Recv: func() (interface{}, error) {
+			req, err := stream.Recv()
+			if err != nil {
+				return nil, err
+			}
+			return decodeGRPCSumRequest(ctx, req)
+		},
+		Send: func(response interface{}) error {
+			return stream.Send(encodeGRPCSumResult(response.(addendpoint.SumResponse)))
+		},
+	})
+	if err != nil {
+		s.errorHandler.Handle(ctx, err)
+		return err2status(err)
+	}
+	return nil
+}
+
+func (s *grpcServer) Batch(ctx context.Context, req *pb.BatchRequest) (*pb.BatchResponse, error) {
+	_, resp, err := s.batch.ServeGRPC(ctx, req)
+	if err != nil {
+		return nil, err2status(err)
+	}
+	return resp.(*pb.BatchResponse), nil
+}
+
+func NewGRPCClient(conn *grpc.ClientConn, cfg ClientConfig, logger log.Logger, stateChanges, rejections metrics.Counter) addservice.Service {
+	limiter := ratelimit.NewErroringLimiter(cfg.RateLimit.NewLimiter())
 
 	var sumEndpoint endpoint.Endpoint
 	{
@@ -73,12 +182,17 @@ func NewGRPCClient(conn *grpc.ClientConn, logger log.Logger) addservice.Service
 			encodeGRPCSumRequest,
 			decodeGRPCSumResponse,
 			pb.SumResponse{},
+			grpctransport.ClientBefore(
+				grpctransport.SetRequestHeader(errorModeKey, errorModeStatus),
+				contextToGRPC,
+			),
 		).Endpoint()
+		sumEndpoint = statusErrorMiddleware(func(err error) interface{} {
+			return addendpoint.SumResponse{Err: err}
+		})(sumEndpoint)
 		sumEndpoint = limiter(sumEndpoint)
-		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
-			Name:    "Sum",
-			Timeout: 30 * time.Second,
-		}))(sumEndpoint)
+		sumEndpoint = addendpoint.RejectionMiddleware(rejections.With("method", "Sum"))(sumEndpoint)
+		sumEndpoint = cfg.circuitBreaker("Sum", stateChanges)(sumEndpoint)
 	}
 
 	var concatEndpoint endpoint.Endpoint
@@ -90,28 +204,137 @@ func NewGRPCClient(conn *grpc.ClientConn, logger log.Logger) addservice.Service
 			encodeGRPCConcatRequest,
 			decodeGRPCConcatResponse,
 			pb.ConcatResponse{},
+			grpctransport.ClientBefore(
+				grpctransport.SetRequestHeader(errorModeKey, errorModeStatus),
+				contextToGRPC,
+			),
 		).Endpoint()
+		concatEndpoint = statusErrorMiddleware(func(err error) interface{} {
+			return addendpoint.ConcatResponse{Err: err}
+		})(concatEndpoint)
 		concatEndpoint = limiter(concatEndpoint)
-		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
-			Name:    "Concat",
-			Timeout: 10 * time.Second,
-		}))(concatEndpoint)
+		concatEndpoint = addendpoint.RejectionMiddleware(rejections.With("method", "Concat"))(concatEndpoint)
+		concatEndpoint = cfg.circuitBreaker("Concat", stateChanges)(concatEndpoint)
+	}
+
+	var sumDecimalEndpoint endpoint.Endpoint
+	{
+		sumDecimalEndpoint = grpctransport.NewClient(
+			conn,
+			"pb.AddService",
+			"SumDecimal",
+			encodeGRPCSumDecimalRequest,
+			decodeGRPCSumDecimalResponse,
+			pb.SumDecimalResponse{},
+			grpctransport.ClientBefore(contextToGRPC),
+		).Endpoint()
+		sumDecimalEndpoint = statusErrorMiddleware(func(err error) interface{} {
+			return addendpoint.SumDecimalResponse{Err: err}
+		})(sumDecimalEndpoint)
+		sumDecimalEndpoint = limiter(sumDecimalEndpoint)
+		sumDecimalEndpoint = addendpoint.RejectionMiddleware(rejections.With("method", "SumDecimal"))(sumDecimalEndpoint)
+		sumDecimalEndpoint = cfg.circuitBreaker("SumDecimal", stateChanges)(sumDecimalEndpoint)
+	}
+
+	var evalEndpoint endpoint.Endpoint
+	{
+		evalEndpoint = grpctransport.NewClient(
+			conn,
+			"pb.AddService",
+			"Eval",
+			encodeGRPCEvalRequest,
+			decodeGRPCEvalResponse,
+			pb.EvalResponse{},
+			grpctransport.ClientBefore(contextToGRPC),
+		).Endpoint()
+		evalEndpoint = statusErrorMiddleware(func(err error) interface{} {
+			return addendpoint.EvalResponse{Err: err}
+		})(evalEndpoint)
+		evalEndpoint = limiter(evalEndpoint)
+		evalEndpoint = addendpoint.RejectionMiddleware(rejections.With("method", "Eval"))(evalEndpoint)
+		evalEndpoint = cfg.circuitBreaker("Eval", stateChanges)(evalEndpoint)
 	}
 
 	return addendpoint.Set{
-		SumEndpoint:    sumEndpoint,
-		ConcatEndpoint: concatEndpoint,
+		SumEndpoint:        sumEndpoint,
+		ConcatEndpoint:     concatEndpoint,
+		SumDecimalEndpoint: sumDecimalEndpoint,
+		EvalEndpoint:       evalEndpoint,
 	}
 }
 
 func decodeGRPCSumRequest(_ context.Context, request interface{}) (interface{}, error) {
 	req := request.(*pb.SumRequest)
-	return addendpoint.SumRequest{A: int(req.A), B: int(req.B)}, nil
+	return addendpoint.SumRequest{A: int(req.A), B: int(req.B), Mode: req.Mode}, nil
 }
 
 func decodeGRPCConcatRequest(_ context.Context, request interface{}) (interface{}, error) {
 	req := request.(*pb.ConcatRequest)
-	return addendpoint.ConcatRequest{A: req.A, B: req.B}, nil
+	return addendpoint.ConcatRequest{A: req.A, B: req.B, LengthUnit: req.LengthUnit, Normalization: req.Normalization}, nil
+}
+
+func decodeGRPCSumDecimalRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.SumDecimalRequest)
+	return addendpoint.SumDecimalRequest{A: req.A, B: req.B, Mode: req.Mode}, nil
+}
+
+func decodeGRPCEvalRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.EvalRequest)
+	vars, err := decodeGRPCVars(req.Vars)
+	if err != nil {
+		return nil, invalidRequest("%v", err)
+	}
+	return addendpoint.EvalRequest{Expr: req.Expr, Vars: vars}, nil
+}
+
+func decodeGRPCVars(vars map[string]*pb.Value) (map[string]addendpoint.Value, error) {
+	values := make(map[string]addendpoint.Value, len(vars))
+	for name, v := range vars {
+		value, ok := decodeGRPCValue(v)
+		if !ok {
+			return nil, fmt.Errorf("vars[%s]: want one of int and str", name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+func decodeGRPCBatchSumRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.BatchSumRequest)
+	items := make([]addendpoint.SumRequest, len(req.Items))
+	for i, item := range req.Items {
+		items[i] = addendpoint.SumRequest{A: int(item.A), B: int(item.B), Mode: item.Mode}
+	}
+	return addendpoint.BatchSumRequest{Items: items}, nil
+}
+
+func decodeGRPCBatchRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(*pb.BatchRequest)
+	ops := make([]addendpoint.Operation, len(req.Operations))
+	for i, op := range req.Operations {
+		switch m := op.Method.(type) {
+		case *pb.Operation_Sum:
+			ops[i].Sum = &addendpoint.SumRequest{A: int(m.Sum.A), B: int(m.Sum.B), Mode: m.Sum.Mode}
+		case *pb.Operation_Concat:
+			ops[i].Concat = &addendpoint.ConcatRequest{
+				A:             m.Concat.A,
+				B:             m.Concat.B,
+				LengthUnit:    m.Concat.LengthUnit,
+				Normalization: m.Concat.Normalization,
+			}
+		case *pb.Operation_SumDecimal:
+			ops[i].SumDecimal = &addendpoint.SumDecimalRequest{A: m.SumDecimal.A, B: m.SumDecimal.B, Mode: m.SumDecimal.Mode}
+		case *pb.Operation_Eval:
+			vars, err := decodeGRPCVars(m.Eval.Vars)
+			if err != nil {
+				return nil, invalidRequest("operations[%d].eval: %v", i, err)
+			}
+			ops[i].Eval = &addendpoint.EvalRequest{Expr: m.Eval.Expr, Vars: vars}
+		default:
+			return nil, invalidRequest("operations[%d]: no method", i)
+		}
+	}
+	return addendpoint.BatchRequest{Operations: ops}, nil
 }
 
 func decodeGRPCSumResponse(_ context.Context, response interface{}) (interface{}, error) {
@@ -124,30 +347,243 @@ func decodeGRPCConcatResponse(_ context.Context, response interface{}) (interfac
 	return addendpoint.ConcatResponse{V: resp.V, Err: str2err(resp.Err)}, nil
 }
 
-func encodeGRPCSumResponse(_ context.Context, response interface{}) (interface{}, error) {
+func decodeGRPCSumDecimalResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*pb.SumDecimalResponse)
+	return addendpoint.SumDecimalResponse{V: resp.V}, nil
+}
+
+func decodeGRPCEvalResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(*pb.EvalResponse)
+	v, _ := decodeGRPCValue(resp.V)
+	return addendpoint.EvalResponse{V: v}, nil
+}
+
+// decodeGRPCValue reports whether v holds a value.
+func decodeGRPCValue(v *pb.Value) (addendpoint.Value, bool) {
+	switch kind := v.GetKind().(type) {
+	case *pb.Value_Int:
+		n := int(kind.Int)
+		return addendpoint.Value{Int: &n}, true
+	case *pb.Value_Str:
+		return addendpoint.Value{Str: &kind.Str}, true
+	default:
+		return addendpoint.Value{}, false
+	}
+}
+
+func encodeGRPCSumResponse(ctx context.Context, response interface{}) (interface{}, error) {
 	resp := response.(addendpoint.SumResponse)
+	if err := statusError(ctx, resp.Err); err != nil {
+		return nil, err
+	}
 	return &pb.SumResponse{V: int64(resp.V), Err: err2str(resp.Err)}, nil
 }
 
-func encodeGRPCConcatResponse(_ context.Context, response interface{}) (interface{}, error) {
+func encodeGRPCConcatResponse(ctx context.Context, response interface{}) (interface{}, error) {
 	resp := response.(addendpoint.ConcatResponse)
+	if err := statusError(ctx, resp.Err); err != nil {
+		return nil, err
+	}
 	return &pb.ConcatResponse{V: resp.V, Err: err2str(resp.Err)}, nil
 }
 
+// encodeGRPCSumDecimalResponse always fails with a status error, as
+// SumDecimal has no legacy clients.
+func encodeGRPCSumDecimalResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(addendpoint.SumDecimalResponse)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return &pb.SumDecimalResponse{V: resp.V}, nil
+}
+
+// encodeGRPCEvalResponse always fails with a status error, as Eval has no
+// legacy clients.
+func encodeGRPCEvalResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(addendpoint.EvalResponse)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return &pb.EvalResponse{V: encodeGRPCValue(resp.V)}, nil
+}
+
+func encodeGRPCValue(v addendpoint.Value) *pb.Value {
+	if v.Str != nil {
+		return &pb.Value{Kind: &pb.Value_Str{Str: *v.Str}}
+	}
+	var n int
+	if v.Int != nil {
+		n = *v.Int
+	}
+	return &pb.Value{Kind: &pb.Value_Int{Int: int64(n)}}
+}
+
+// encodeGRPCBatchSumResponse always fails with a status error, as BatchSum
+// has no legacy clients.
+func encodeGRPCBatchSumResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(addendpoint.BatchSumResponse)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	results := make([]*pb.SumResult, len(resp.Results))
+	for i, result := range resp.Results {
+		results[i] = encodeGRPCSumResult(result)
+	}
+	return &pb.BatchSumResponse{Results: results}, nil
+}
+
+func encodeGRPCBatchResponse(_ context.Context, response interface{}) (interface{}, error) {
+	resp := response.(addendpoint.BatchResponse)
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	results := make([]*pb.OperationResult, len(resp.Results))
+	for i, result := range resp.Results {
+		r := &pb.OperationResult{}
+		switch {
+		case result.Err != nil:
+			r.Error = proto.String(result.Err.Error())
+			if spec, ok := addservice.LookupError(result.Err); ok {
+				r.Reason = proto.String(spec.Reason)
+			}
+		case result.Sum != nil:
+			r.Method = &pb.OperationResult_Sum{Sum: &pb.SumResponse{V: int64(result.Sum.V)}}
+		case result.Concat != nil:
+			r.Method = &pb.OperationResult_Concat{Concat: &pb.ConcatResponse{V: result.Concat.V}}
+		case result.SumDecimal != nil:
+			r.Method = &pb.OperationResult_SumDecimal{SumDecimal: &pb.SumDecimalResponse{V: result.SumDecimal.V}}
+		case result.Eval != nil:
+			r.Method = &pb.OperationResult_Eval{Eval: &pb.EvalResponse{V: encodeGRPCValue(result.Eval.V)}}
+		}
+		results[i] = r
+	}
+	return &pb.BatchResponse{Results: results}, nil
+}
+
+func encodeGRPCSumResult(resp addendpoint.SumResponse) *pb.SumResult {
+	result := &pb.SumResult{V: int64(resp.V)}
+	if resp.Err != nil {
+		result.Error = proto.String(resp.Err.Error())
+		if spec, ok := addservice.LookupError(resp.Err); ok {
+			result.Reason = proto.String(spec.Reason)
+		}
+	}
+	return result
+}
+
 func encodeGRPCSumRequest(_ context.Context, request interface{}) (interface{}, error) {
 	req := request.(addendpoint.SumRequest)
-	return &pb.SumRequest{A: int64(req.A), B: int64(req.B)}, nil
+	return &pb.SumRequest{A: int64(req.A), B: int64(req.B), Mode: req.Mode}, nil
+}
+
+func encodeGRPCSumDecimalRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(addendpoint.SumDecimalRequest)
+	return &pb.SumDecimalRequest{A: req.A, B: req.B, Mode: req.Mode}, nil
+}
+
+func encodeGRPCEvalRequest(_ context.Context, request interface{}) (interface{}, error) {
+	req := request.(addendpoint.EvalRequest)
+	return &pb.EvalRequest{Expr: req.Expr, Vars: encodeGRPCVars(req.Vars)}, nil
+}
+
+func encodeGRPCVars(vars map[string]addendpoint.Value) map[string]*pb.Value {
+	values := make(map[string]*pb.Value, len(vars))
+	for name, v := range vars {
+		values[name] = encodeGRPCValue(v)
+	}
+	return values
 }
 
 func encodeGRPCConcatRequest(_ context.Context, request interface{}) (interface{}, error) {
 	req := request.(addendpoint.ConcatRequest)
-	return &pb.ConcatRequest{A: req.A, B: req.B}, nil
+	return &pb.ConcatRequest{A: req.A, B: req.B, LengthUnit: req.LengthUnit, Normalization: req.Normalization}, nil
 }
 
+func extractErrorMode(ctx context.Context, md metadata.MD) context.Context {
+	if v := md.Get(errorModeKey); len(v) > 0 {
+		ctx = context.WithValue(ctx, errorModeContextKey, v[0])
+	}
+	return ctx
+}
+
+func statusErrorsAccepted(ctx context.Context) bool {
+	mode, _ := ctx.Value(errorModeContextKey).(string)
+	return mode == errorModeStatus
+}
+
+// statusError returns the gRPC status for a registered service error if the
+// client asked for status errors, and nil if the legacy err field should be
+// used instead.
+func statusError(ctx context.Context, err error) error {
+	if err == nil || !statusErrorsAccepted(ctx) {
+		return nil
+	}
+	if _, ok := addservice.LookupError(err); !ok {
+		return nil
+	}
+	return err2status(err)
+}
+
+// statusErrorMiddleware turns service errors carried in a gRPC status back
+// into a failed response, so that they reach the caller as business errors
+// instead of tripping circuit breakers and retries further up the chain.
+// Retryable errors are left as transport errors on purpose.
+func statusErrorMiddleware(newResponse func(error) interface{}) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			response, err := next(ctx, request)
+			if err != nil {
+				if spec, ok := status2spec(err); ok {
+					if spec.Retryable {
+						return nil, spec.Err
+					}
+					return newResponse(spec.Err), nil
+				}
+			}
+			return response, err
+		}
+	}
+}
+
+func err2status(err error) error {
+	spec, ok := addservice.LookupError(err)
+	if !ok {
+		return err
+	}
+	st, detailErr := status.New(spec.GRPCCode, err.Error()).WithDetails(&errdetails.ErrorInfo{
+		Reason: spec.Reason,
+		Domain: errorDomain,
+	})
+	if detailErr != nil {
+		return status.Error(spec.GRPCCode, err.Error())
+	}
+	return st.Err()
+}
+
+func status2spec(err error) (addservice.ErrorSpec, bool) {
+	st, ok := status.FromError(err)
+	if !ok {
+		return addservice.ErrorSpec{}, false
+	}
+	for _, detail := range st.Details() {
+		info, ok := detail.(*errdetails.ErrorInfo)
+		if !ok || info.Domain != errorDomain {
+			continue
+		}
+		return addservice.LookupReason(info.Reason)
+	}
+	return addservice.ErrorSpec{}, false
+}
+
+// str2err still understands the legacy err field, so a new client talking to
+// an old server gets the same sentinel errors back.
 func str2err(s string) error {
 	if s == "" {
 		return nil
 	}
+	if spec, ok := addservice.LookupMessage(s); ok {
+		return spec.Err
+	}
 	return errors.New(s)
 }
 
@@ -3,57 +3,127 @@ package addtransport
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
-	"time"
 
-	"github.com/go-kit/kit/circuitbreaker"
 	"github.com/go-kit/kit/endpoint"
 	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
 	"github.com/go-kit/kit/ratelimit"
 	"github.com/go-kit/kit/transport"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/maolonglong/microservices-example/pkg/addendpoint"
 	"github.com/maolonglong/microservices-example/pkg/addservice"
-	"github.com/sony/gobreaker"
-	"golang.org/x/time/rate"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
-func NewHTTPHandler(endpoints addendpoint.Set, logger log.Logger) http.Handler {
+func NewHTTPHandler(endpoints addendpoint.Set, logger log.Logger, tracer trace.Tracer) http.Handler {
 	options := []httptransport.ServerOption{
 		httptransport.ServerErrorEncoder(errorEncoder),
 		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerBefore(negotiateResponseCodec, httpToContext),
 	}
 
-	r := mux.NewRouter()
-	r.Methods(http.MethodGet).Path("/sum").Handler(httptransport.NewServer(
+	sumServer := httptransport.NewServer(
 		endpoints.SumEndpoint,
 		decodeHTTPSumRequest,
 		encodeHTTPGenericResponse,
 		options...,
-	))
-
-	r.Methods(http.MethodGet).Path("/concat").Handler(httptransport.NewServer(
+	)
+	concatServer := httptransport.NewServer(
 		endpoints.ConcatEndpoint,
 		decodeHTTPConcatRequest,
 		encodeHTTPGenericResponse,
 		options...,
-	))
-
-	r.Methods(http.MethodGet).Path("/health").HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
-		w.Header().Set("Content-Type", "application/json; charset=utf8")
-		w.Write([]byte(`{"status":"ok"}`))
+	)
+	sumDecimalServer := httptransport.NewServer(
+		endpoints.SumDecimalEndpoint,
+		decodeHTTPSumDecimalRequest,
+		encodeHTTPGenericResponse,
+		options...,
+	)
+	evalServer := httptransport.NewServer(
+		endpoints.EvalEndpoint,
+		decodeHTTPEvalRequest,
+		encodeHTTPGenericResponse,
+		options...,
+	)
+	batchSumServer := httptransport.NewServer(
+		endpoints.BatchSumEndpoint,
+		decodeHTTPBatchSumRequest,
+		encodeHTTPBatchSumResponse,
+		options...,
+	)
+	batchServer := httptransport.NewServer(
+		endpoints.BatchEndpoint,
+		decodeHTTPBatchRequest,
+		encodeHTTPBatchResponse,
+		options...,
+	)
+	sumStreamHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recv, err := ndjsonRecv(r, decodeSumLine)
+		if err != nil {
+			errorEncoder(r.Context(), err, w)
+			return
+		}
+		serveStream(r.Context(), w, endpoints.SumStreamEndpoint, recv, func(response interface{}) interface{} {
+			return newSumResult(response.(addendpoint.SumResponse))
+		}, transport.NewLogErrorHandler(logger))
 	})
 
-	return r
+	// Routes without an endpoint, like the batches behind a gateway that
+	// only forwards the methods of addservice.Service, answer 501.
+	available := availablePaths(endpoints)
+	r := mux.NewRouter()
+	route := func(path string, h http.Handler, methods ...string) {
+		if !available[path] {
+			h = http.HandlerFunc(notImplemented)
+		}
+		r.Methods(methods...).Path(path).Handler(h)
+	}
+	route("/v1/sum", sumServer, http.MethodGet, http.MethodPost)
+	route("/v1/concat", concatServer, http.MethodGet, http.MethodPost)
+	route("/v1/sum:decimal", sumDecimalServer, http.MethodGet, http.MethodPost)
+	route("/v1/sum:batch", batchSumServer, http.MethodPost)
+	route("/v1/sum:stream", sumStreamHandler, http.MethodPost)
+	route("/v1/batch", batchServer, http.MethodPost)
+	route("/v1/eval", evalServer, http.MethodPost)
+	r.Methods(http.MethodGet).Path("/openapi.json").Handler(OpenAPIHandler(endpoints))
+
+	// The unversioned paths predate /v1 and are kept for existing clients.
+	r.Methods(http.MethodGet, http.MethodPost).Path("/sum").Handler(sumServer)
+	r.Methods(http.MethodGet, http.MethodPost).Path("/concat").Handler(concatServer)
+
+	return tracingHandler(tracer, r)
+}
+
+// availablePaths tells which versioned routes of NewHTTPHandler have an
+// endpoint in endpoints.
+func availablePaths(endpoints addendpoint.Set) map[string]bool {
+	return map[string]bool{
+		"/v1/sum":         endpoints.SumEndpoint != nil,
+		"/v1/concat":      endpoints.ConcatEndpoint != nil,
+		"/v1/sum:decimal": endpoints.SumDecimalEndpoint != nil,
+		"/v1/sum:batch":   endpoints.BatchSumEndpoint != nil,
+		"/v1/sum:stream":  endpoints.SumStreamEndpoint != nil,
+		"/v1/batch":       endpoints.BatchEndpoint != nil,
+		"/v1/eval":        endpoints.EvalEndpoint != nil,
+	}
+}
+
+func notImplemented(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, status.Errorf(codes.Unimplemented, "%s is not available here", r.URL.Path))
 }
 
-func NewHTTPClient(instance string, logger log.Logger) (addservice.Service, error) {
+func NewHTTPClient(instance string, cfg ClientConfig, logger log.Logger, stateChanges, rejections metrics.Counter) (addservice.Service, error) {
 	if !strings.HasPrefix(instance, "http") {
 		instance = "http://" + instance
 	}
@@ -62,112 +132,486 @@ func NewHTTPClient(instance string, logger log.Logger) (addservice.Service, erro
 		return nil, err
 	}
 
-	limiter := ratelimit.NewErroringLimiter(rate.NewLimiter(rate.Every(time.Second), 100))
+	c, err := clientCodec(cfg.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	limiter := ratelimit.NewErroringLimiter(cfg.RateLimit.NewLimiter())
 
 	var sumEndpoint endpoint.Endpoint
 	{
 		sumEndpoint = httptransport.NewClient(
-			http.MethodGet,
-			copyURL(u, "/sum"),
-			encodeHTTPGenericRequest,
+			http.MethodPost,
+			copyURL(u, "/v1/sum"),
+			encodeHTTPRequest(c),
 			decodeHTTPSumResponse,
+			httptransport.ClientBefore(contextToHTTP),
 		).Endpoint()
 		sumEndpoint = limiter(sumEndpoint)
-		sumEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
-			Name:    "Sum",
-			Timeout: 30 * time.Second,
-		}))(sumEndpoint)
+		sumEndpoint = addendpoint.RejectionMiddleware(rejections.With("method", "Sum"))(sumEndpoint)
+		sumEndpoint = cfg.circuitBreaker("Sum", stateChanges)(sumEndpoint)
 	}
 
 	var concatEndpoint endpoint.Endpoint
 	{
 		concatEndpoint = httptransport.NewClient(
-			http.MethodGet,
-			copyURL(u, "/concat"),
-			encodeHTTPGenericRequest,
+			http.MethodPost,
+			copyURL(u, "/v1/concat"),
+			encodeHTTPRequest(c),
 			decodeHTTPConcatResponse,
+			httptransport.ClientBefore(contextToHTTP),
 		).Endpoint()
 		concatEndpoint = limiter(concatEndpoint)
-		concatEndpoint = circuitbreaker.Gobreaker(gobreaker.NewCircuitBreaker(gobreaker.Settings{
-			Name:    "Concat",
-			Timeout: 10 * time.Second,
-		}))(concatEndpoint)
+		concatEndpoint = addendpoint.RejectionMiddleware(rejections.With("method", "Concat"))(concatEndpoint)
+		concatEndpoint = cfg.circuitBreaker("Concat", stateChanges)(concatEndpoint)
+	}
+
+	var sumDecimalEndpoint endpoint.Endpoint
+	{
+		sumDecimalEndpoint = httptransport.NewClient(
+			http.MethodPost,
+			copyURL(u, "/v1/sum:decimal"),
+			encodeHTTPRequest(c),
+			decodeHTTPSumDecimalResponse,
+			httptransport.ClientBefore(contextToHTTP),
+		).Endpoint()
+		sumDecimalEndpoint = limiter(sumDecimalEndpoint)
+		sumDecimalEndpoint = addendpoint.RejectionMiddleware(rejections.With("method", "SumDecimal"))(sumDecimalEndpoint)
+		sumDecimalEndpoint = cfg.circuitBreaker("SumDecimal", stateChanges)(sumDecimalEndpoint)
+	}
+
+	var evalEndpoint endpoint.Endpoint
+	{
+		evalEndpoint = httptransport.NewClient(
+			http.MethodPost,
+			copyURL(u, "/v1/eval"),
+			encodeHTTPRequest(c),
+			decodeHTTPEvalResponse,
+			httptransport.ClientBefore(contextToHTTP),
+		).Endpoint()
+		evalEndpoint = limiter(evalEndpoint)
+		evalEndpoint = addendpoint.RejectionMiddleware(rejections.With("method", "Eval"))(evalEndpoint)
+		evalEndpoint = cfg.circuitBreaker("Eval", stateChanges)(evalEndpoint)
 	}
 
 	return addendpoint.Set{
-		SumEndpoint:    sumEndpoint,
-		ConcatEndpoint: concatEndpoint,
+		SumEndpoint:        sumEndpoint,
+		ConcatEndpoint:     concatEndpoint,
+		SumDecimalEndpoint: sumDecimalEndpoint,
+		EvalEndpoint:       evalEndpoint,
 	}, nil
 }
 
+// copyURL appends path to the one of base, so that clients also work behind
+// a prefix such as the gateway's /addsvc.
 func copyURL(base *url.URL, path string) *url.URL {
 	next := *base
-	next.Path = path
+	next.Path = strings.TrimSuffix(base.Path, "/") + path
 	return &next
 }
 
-func errorEncoder(_ context.Context, err error, w http.ResponseWriter) {
-	w.WriteHeader(err2code(err))
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	json.NewEncoder(w).Encode(errorWrapper{Error: err.Error()})
+// WriteError answers r with err the way the handlers of this package do, for
+// HTTP middlewares in front of them.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	errorEncoder(negotiateResponseCodec(r.Context(), r), err, w)
 }
 
-func err2code(err error) int {
-	switch err {
-	case addservice.ErrTwoZeroes, addservice.ErrMaxSizeExceeded, addservice.ErrIntOverflow:
+func errorEncoder(ctx context.Context, err error, w http.ResponseWriter) {
+	code, wrapper := wrapError(err)
+	c := responseCodec(ctx)
+	body, marshalErr := c.marshal(wrapper)
+	if marshalErr != nil {
+		c = codecs[0]
+		body, _ = c.marshal(wrapper)
+	}
+	w.Header().Set("Content-Type", c.contentType())
+	w.Header().Set("Vary", "Accept")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// wrapError returns the HTTP status and body for err.
+func wrapError(err error) (int, errorWrapper) {
+	code, wrapper := http.StatusInternalServerError, errorWrapper{Error: err.Error()}
+	if spec, ok := addservice.LookupError(err); ok {
+		code = spec.HTTPStatus
+		wrapper.Reason = spec.Reason
+		wrapper.Retryable = spec.Retryable
+	} else if st, ok := status.FromError(err); ok {
+		code = httpStatusFromCode(st.Code())
+		wrapper.Error = st.Message()
+	}
+	return code, wrapper
+}
+
+// httpStatusFromCode maps the status of gRPC errors that are not registered
+// service errors, as seen by the transcoding handler.
+func httpStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
 		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
 	}
-	return http.StatusInternalServerError
 }
 
 type errorWrapper struct {
-	Error string `json:"error"`
+	Error     string `json:"error"`
+	Reason    string `json:"reason,omitempty"`
+	Retryable bool   `json:"retryable,omitempty"`
+}
+
+// decodeHTTPError turns a non-200 response back into the registered service
+// error. Business errors are returned as the first value so callers can put
+// them into the endpoint response; retryable and unknown errors are returned
+// as the second value and treated as transport failures.
+func decodeHTTPError(r *http.Response) (serviceErr, transportErr error) {
+	var w errorWrapper
+	if err := decodeHTTPResponseBody(r, &w); err != nil {
+		return nil, errors.New(r.Status)
+	}
+	spec, ok := addservice.LookupReason(w.Reason)
+	if !ok {
+		spec, ok = addservice.LookupMessage(w.Error)
+	}
+	switch {
+	case !ok && w.Error != "":
+		return nil, fmt.Errorf("%s: %s", r.Status, w.Error)
+	case !ok:
+		return nil, errors.New(r.Status)
+	case spec.Retryable:
+		return nil, spec.Err
+	default:
+		return spec.Err, nil
+	}
+}
+
+// ErrInvalidRequest is wrapped by every error about a malformed request, so
+// that the details reach the caller along with a 400.
+var ErrInvalidRequest = addservice.RegisterError(addservice.ErrorSpec{
+	Err:        errors.New("invalid request"),
+	Reason:     "INVALID_REQUEST",
+	HTTPStatus: http.StatusBadRequest,
+	GRPCCode:   codes.InvalidArgument,
+})
+
+var ErrUnsupportedMediaType = addservice.RegisterError(addservice.ErrorSpec{
+	Err:        errors.New("unsupported media type"),
+	Reason:     "UNSUPPORTED_MEDIA_TYPE",
+	HTTPStatus: http.StatusUnsupportedMediaType,
+	GRPCCode:   codes.InvalidArgument,
+})
+
+func invalidRequest(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRequest, fmt.Sprintf(format, args...))
 }
 
 func decodeHTTPSumRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var req addendpoint.SumRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := decodeHTTPRequest(r, &req)
 	return req, err
 }
 
 func decodeHTTPConcatRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	var req addendpoint.ConcatRequest
-	err := json.NewDecoder(r.Body).Decode(&req)
+	err := decodeHTTPRequest(r, &req)
 	return req, err
 }
 
+func decodeHTTPSumDecimalRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req addendpoint.SumDecimalRequest
+	err := decodeHTTPRequest(r, &req)
+	return req, err
+}
+
+func decodeHTTPEvalRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req addendpoint.EvalRequest
+	if err := decodeHTTPRequest(r, &req); err != nil {
+		return nil, err
+	}
+	if err := checkVars(req.Vars); err != nil {
+		return nil, invalidRequest("%v", err)
+	}
+	return req, nil
+}
+
+// checkVars requires every variable to be either an integer or a string.
+func checkVars(vars map[string]addendpoint.Value) error {
+	for name, v := range vars {
+		if (v.Int == nil) == (v.Str == nil) {
+			return fmt.Errorf("vars[%s]: want exactly one of int and str", name)
+		}
+	}
+	return nil
+}
+
+func decodeHTTPBatchSumRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req addendpoint.BatchSumRequest
+	err := decodeHTTPRequest(r, &req)
+	return req, err
+}
+
+func decodeHTTPBatchRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var req addendpoint.BatchRequest
+	if err := decodeHTTPRequest(r, &req); err != nil {
+		return nil, err
+	}
+	for i, op := range req.Operations {
+		set := 0
+		for _, method := range []bool{op.Sum != nil, op.Concat != nil, op.SumDecimal != nil, op.Eval != nil} {
+			if method {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, invalidRequest("operations[%d]: want exactly one of sum, concat, sum_decimal and eval", i)
+		}
+		if op.Eval != nil {
+			if err := checkVars(op.Eval.Vars); err != nil {
+				return nil, invalidRequest("operations[%d].eval: %v", i, err)
+			}
+		}
+	}
+	return req, nil
+}
+
+func decodeSumLine(line []byte) (interface{}, error) {
+	var req addendpoint.SumRequest
+	err := unmarshalJSON(line, &req, true)
+	return req, err
+}
+
+// decodeHTTPRequest takes the arguments from the query of a GET, or from the
+// body of a POST in the encoding given by its Content-Type. A GET with a body
+// and no query is read like a POST, which is what clients before the query
+// form sent.
+func decodeHTTPRequest(r *http.Request, v interface{}) error {
+	hasBody := r.Method == http.MethodPost ||
+		r.URL.RawQuery == "" && r.ContentLength != 0 && r.Body != nil && r.Body != http.NoBody
+	if !hasBody {
+		query, err := url.ParseQuery(r.URL.RawQuery)
+		if err != nil {
+			return invalidRequest("query: %v", err)
+		}
+		if err := decodeValues(query, v, true); err != nil {
+			return invalidRequest("query: %v", err)
+		}
+		return nil
+	}
+	c, err := contentCodec(r.Header)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return invalidRequest("body: %v", err)
+	}
+	if err := c.unmarshal(data, v, true); err != nil {
+		if errors.Is(err, addservice.ErrInvalidUTF8) {
+			return err
+		}
+		return invalidRequest("body: %v", err)
+	}
+	return nil
+}
+
+// negotiateResponseCodec remembers the encoding the client accepts for the
+// encoders further down.
+func negotiateResponseCodec(ctx context.Context, r *http.Request) context.Context {
+	return context.WithValue(ctx, responseCodecContextKey, acceptCodec(r.Header))
+}
+
+func responseCodec(ctx context.Context) codec {
+	if c, ok := ctx.Value(responseCodecContextKey).(codec); ok {
+		return c
+	}
+	return codecs[0]
+}
+
 func decodeHTTPSumResponse(_ context.Context, r *http.Response) (interface{}, error) {
 	if r.StatusCode != http.StatusOK {
-		return nil, errors.New(r.Status)
+		serviceErr, err := decodeHTTPError(r)
+		if err != nil {
+			return nil, err
+		}
+		return addendpoint.SumResponse{Err: serviceErr}, nil
 	}
 	var resp addendpoint.SumResponse
-	err := json.NewDecoder(r.Body).Decode(&resp)
+	err := decodeHTTPResponseBody(r, &resp)
 	return resp, err
 }
 
 func decodeHTTPConcatResponse(_ context.Context, r *http.Response) (interface{}, error) {
 	if r.StatusCode != http.StatusOK {
-		return nil, errors.New(r.Status)
+		serviceErr, err := decodeHTTPError(r)
+		if err != nil {
+			return nil, err
+		}
+		return addendpoint.ConcatResponse{Err: serviceErr}, nil
 	}
 	var resp addendpoint.ConcatResponse
-	err := json.NewDecoder(r.Body).Decode(&resp)
+	err := decodeHTTPResponseBody(r, &resp)
+	return resp, err
+}
+
+func decodeHTTPSumDecimalResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode != http.StatusOK {
+		serviceErr, err := decodeHTTPError(r)
+		if err != nil {
+			return nil, err
+		}
+		return addendpoint.SumDecimalResponse{Err: serviceErr}, nil
+	}
+	var resp addendpoint.SumDecimalResponse
+	err := decodeHTTPResponseBody(r, &resp)
+	return resp, err
+}
+
+func decodeHTTPEvalResponse(_ context.Context, r *http.Response) (interface{}, error) {
+	if r.StatusCode != http.StatusOK {
+		serviceErr, err := decodeHTTPError(r)
+		if err != nil {
+			return nil, err
+		}
+		return addendpoint.EvalResponse{Err: serviceErr}, nil
+	}
+	var resp addendpoint.EvalResponse
+	err := decodeHTTPResponseBody(r, &resp)
 	return resp, err
 }
 
+// decodeHTTPResponseBody decodes the body in the encoding the server chose,
+// which need not be the one asked for.
+func decodeHTTPResponseBody(r *http.Response, v interface{}) error {
+	c, err := contentCodec(r.Header)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	return c.unmarshal(data, v, false)
+}
+
+// sumResult is an item of the results of BatchSum and SumStream, with the
+// error of the item, if any, in the shape of an error body.
+type sumResult struct {
+	V      int    `json:"v"`
+	Error  string `json:"error,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func newSumResult(resp addendpoint.SumResponse) sumResult {
+	result := sumResult{V: resp.V}
+	if resp.Err != nil {
+		_, wrapper := wrapError(resp.Err)
+		result.Error, result.Reason = wrapper.Error, wrapper.Reason
+	}
+	return result
+}
+
+type batchSumResult struct {
+	Results []sumResult `json:"results"`
+}
+
+func encodeHTTPBatchSumResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(addendpoint.BatchSumResponse)
+	if resp.Err != nil {
+		return encodeHTTPGenericResponse(ctx, w, resp)
+	}
+	results := make([]sumResult, len(resp.Results))
+	for i, result := range resp.Results {
+		results[i] = newSumResult(result)
+	}
+	return encodeHTTPGenericResponse(ctx, w, batchSumResult{Results: results})
+}
+
+// operationResult is a result of Batch: the response of the method of the
+// operation, or its error.
+type operationResult struct {
+	Sum        *addendpoint.SumResponse        `json:"sum,omitempty"`
+	Concat     *addendpoint.ConcatResponse     `json:"concat,omitempty"`
+	SumDecimal *addendpoint.SumDecimalResponse `json:"sum_decimal,omitempty"`
+	Eval       *addendpoint.EvalResponse       `json:"eval,omitempty"`
+	Error      string                          `json:"error,omitempty"`
+	Reason     string                          `json:"reason,omitempty"`
+}
+
+type batchResult struct {
+	Results []operationResult `json:"results"`
+}
+
+func encodeHTTPBatchResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(addendpoint.BatchResponse)
+	if resp.Err != nil {
+		return encodeHTTPGenericResponse(ctx, w, resp)
+	}
+	results := make([]operationResult, len(resp.Results))
+	for i, result := range resp.Results {
+		results[i] = operationResult{Sum: result.Sum, Concat: result.Concat, SumDecimal: result.SumDecimal, Eval: result.Eval}
+		if result.Err != nil {
+			_, wrapper := wrapError(result.Err)
+			results[i].Error, results[i].Reason = wrapper.Error, wrapper.Reason
+		}
+	}
+	return encodeHTTPGenericResponse(ctx, w, batchResult{Results: results})
+}
+
 func encodeHTTPGenericResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	if f, ok := response.(endpoint.Failer); ok && f.Failed() != nil {
 		errorEncoder(ctx, f.Failed(), w)
 		return nil
 	}
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	return json.NewEncoder(w).Encode(response)
+	// Responses the accepted codec cannot hold, such as nested ones in a
+	// form, fall back to JSON like errors do.
+	c := responseCodec(ctx)
+	if !c.encodes(reflect.TypeOf(response)) {
+		c = codecs[0]
+	}
+	body, err := c.marshal(response)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", c.contentType())
+	w.Header().Set("Vary", "Accept")
+	_, err = w.Write(body)
+	return err
 }
 
-func encodeHTTPGenericRequest(_ context.Context, r *http.Request, request interface{}) error {
-	var buf bytes.Buffer
-	if err := json.NewEncoder(&buf).Encode(request); err != nil {
-		return err
+// encodeHTTPRequest encodes requests with c and asks for responses in the
+// same encoding.
+func encodeHTTPRequest(c codec) httptransport.EncodeRequestFunc {
+	return func(_ context.Context, r *http.Request, request interface{}) error {
+		body, err := c.marshal(request)
+		if err != nil {
+			return err
+		}
+		r.Header.Set("Content-Type", c.contentType())
+		r.Header.Set("Accept", c.mediaType)
+		r.ContentLength = int64(len(body))
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		return nil
 	}
-	r.Body = io.NopCloser(&buf)
-	return nil
 }
@@ -0,0 +1,150 @@
+package addtransport
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+	grpctransport "github.com/go-kit/kit/transport/grpc"
+	"github.com/maolonglong/microservices-example/pb"
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// serviceMethod ties a method of pb.AddService to its counterpart in
+// addservice.Service, with the conversions of both the gRPC server and
+// client.
+type serviceMethod struct {
+	newRequest     func() proto.Message
+	newReply       func() proto.Message
+	decodeRequest  grpctransport.DecodeRequestFunc
+	encodeResponse grpctransport.EncodeResponseFunc
+	encodeRequest  grpctransport.EncodeRequestFunc
+	decodeResponse grpctransport.DecodeResponseFunc
+	newResponse    func(error) interface{}
+	makeEndpoint   func(addservice.Service) endpoint.Endpoint
+}
+
+var serviceMethods = map[protoreflect.Name]serviceMethod{
+	"Sum": {
+		newRequest:     func() proto.Message { return &pb.SumRequest{} },
+		newReply:       func() proto.Message { return &pb.SumResponse{} },
+		decodeRequest:  decodeGRPCSumRequest,
+		encodeResponse: encodeGRPCSumResponse,
+		encodeRequest:  encodeGRPCSumRequest,
+		decodeResponse: decodeGRPCSumResponse,
+		newResponse:    func(err error) interface{} { return addendpoint.SumResponse{Err: err} },
+		makeEndpoint:   addendpoint.MakeSumEndpoint,
+	},
+	"Concat": {
+		newRequest:     func() proto.Message { return &pb.ConcatRequest{} },
+		newReply:       func() proto.Message { return &pb.ConcatResponse{} },
+		decodeRequest:  decodeGRPCConcatRequest,
+		encodeResponse: encodeGRPCConcatResponse,
+		encodeRequest:  encodeGRPCConcatRequest,
+		decodeResponse: decodeGRPCConcatResponse,
+		newResponse:    func(err error) interface{} { return addendpoint.ConcatResponse{Err: err} },
+		makeEndpoint:   addendpoint.MakeConcatEndpoint,
+	},
+	"SumDecimal": {
+		newRequest:     func() proto.Message { return &pb.SumDecimalRequest{} },
+		newReply:       func() proto.Message { return &pb.SumDecimalResponse{} },
+		decodeRequest:  decodeGRPCSumDecimalRequest,
+		encodeResponse: encodeGRPCSumDecimalResponse,
+		encodeRequest:  encodeGRPCSumDecimalRequest,
+		decodeResponse: decodeGRPCSumDecimalResponse,
+		newResponse:    func(err error) interface{} { return addendpoint.SumDecimalResponse{Err: err} },
+		makeEndpoint:   addendpoint.MakeSumDecimalEndpoint,
+	},
+	"Eval": {
+		newRequest:     func() proto.Message { return &pb.EvalRequest{} },
+		newReply:       func() proto.Message { return &pb.EvalResponse{} },
+		decodeRequest:  decodeGRPCEvalRequest,
+		encodeResponse: encodeGRPCEvalResponse,
+		encodeRequest:  encodeGRPCEvalRequest,
+		decodeResponse: decodeGRPCEvalResponse,
+		newResponse:    func(err error) interface{} { return addendpoint.EvalResponse{Err: err} },
+		makeEndpoint:   addendpoint.MakeEvalEndpoint,
+	},
+}
+
+// NewMethodService returns a Service calling the endpoints of the methods of
+// pb.AddService, keyed by full name, that take and return messages like
+// those of NewGRPCMethodClient. Together with NewServiceMethodEndpoints, it
+// lets service middlewares sit in front of them.
+func NewMethodService(endpoints map[protoreflect.FullName]endpoint.Endpoint) addservice.Service {
+	service := pb.File_user_proto.Services().ByName("AddService")
+	e := func(name protoreflect.Name) endpoint.Endpoint {
+		m, next := serviceMethods[name], endpoints[service.FullName().Append(name)]
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			req, err := m.encodeRequest(ctx, request)
+			if err != nil {
+				return nil, err
+			}
+			response, err := next(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			resp := response.(MethodResponse)
+			if resp.Err != nil {
+				return m.newResponse(resp.Err), nil
+			}
+			reply := m.newReply()
+			if err := convertMessage(resp.Message, reply); err != nil {
+				return nil, err
+			}
+			return m.decodeResponse(ctx, reply)
+		}
+	}
+	return addendpoint.Set{
+		SumEndpoint:        e("Sum"),
+		ConcatEndpoint:     e("Concat"),
+		SumDecimalEndpoint: e("SumDecimal"),
+		EvalEndpoint:       e("Eval"),
+	}
+}
+
+// NewServiceMethodEndpoints returns endpoints serving the methods of
+// pb.AddService that have a counterpart in svc, keyed by full name. They
+// take and return messages like those of NewGRPCMethodClient.
+func NewServiceMethodEndpoints(svc addservice.Service) map[protoreflect.FullName]endpoint.Endpoint {
+	service := pb.File_user_proto.Services().ByName("AddService")
+	endpoints := make(map[protoreflect.FullName]endpoint.Endpoint, len(serviceMethods))
+	for name, m := range serviceMethods {
+		m, next := m, m.makeEndpoint(svc)
+		endpoints[service.FullName().Append(name)] = func(ctx context.Context, request interface{}) (interface{}, error) {
+			req := m.newRequest()
+			if err := convertMessage(request.(proto.Message), req); err != nil {
+				return nil, invalidRequest("%v", err)
+			}
+			r, err := m.decodeRequest(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			response, err := next(ctx, r)
+			if err != nil {
+				return nil, err
+			}
+			if err := response.(endpoint.Failer).Failed(); err != nil {
+				return MethodResponse{Err: err}, nil
+			}
+			reply, err := m.encodeResponse(ctx, response)
+			if err != nil {
+				return nil, err
+			}
+			return MethodResponse{Message: reply.(proto.Message)}, nil
+		}
+	}
+	return endpoints
+}
+
+// convertMessage copies src into dst, a message of the same type that may
+// be a dynamic one or not.
+func convertMessage(src, dst proto.Message) error {
+	b, err := proto.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(b, dst)
+}
@@ -0,0 +1,124 @@
+package addtransport
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/transport"
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+)
+
+// Streaming methods take and return newline delimited JSON over HTTP: one
+// request per line, and one line per response, flushed as soon as it is
+// ready. Every response line is {"result": ...}; a stream that fails after
+// the first result ends with a line holding the error instead, shaped like
+// the error bodies of the unary routes.
+const mediaTypeNDJSON = "application/x-ndjson"
+
+const (
+	// maxStreamBody bounds the request body of a stream read ahead over
+	// HTTP/1.x, see ndjsonRecv.
+	maxStreamBody = 32 << 20
+	// maxStreamLine bounds a single line of a stream.
+	maxStreamLine = 1 << 20
+)
+
+type streamLine struct {
+	Result interface{} `json:"result,omitempty"`
+	*errorWrapper
+}
+
+// ndjsonRecv returns a function reading the requests of a stream from the
+// body of r, one line at a time, decoded by decode. HTTP/1.x cannot read
+// the request while writing the response, so there the body is read in full
+// before the stream starts; the results are still streamed back.
+func ndjsonRecv(r *http.Request, decode func(line []byte) (interface{}, error)) (func() (interface{}, error), error) {
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err != nil || mediaType != mediaTypeNDJSON && mediaType != mediaTypeJSON {
+			return nil, fmt.Errorf("%w: %s, want %s", ErrUnsupportedMediaType, ct, mediaTypeNDJSON)
+		}
+	}
+	var body io.Reader = r.Body
+	if r.ProtoMajor < 2 {
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxStreamBody+1))
+		if err != nil {
+			return nil, invalidRequest("body: %v", err)
+		}
+		if len(data) > maxStreamBody {
+			return nil, invalidRequest("body: larger than %d bytes", maxStreamBody)
+		}
+		body = bytes.NewReader(data)
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, maxStreamLine)
+	line := 0
+	return func() (interface{}, error) {
+		for scanner.Scan() {
+			line++
+			if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+				continue
+			}
+			req, err := decode(scanner.Bytes())
+			if err != nil {
+				return nil, invalidRequest("line %d: %v", line, err)
+			}
+			return req, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, invalidRequest("line %d: %v", line+1, err)
+		}
+		return nil, io.EOF
+	}, nil
+}
+
+// serveStream runs the streaming endpoint e with requests from recv, and
+// writes every response as converted by encode. Failures before the first
+// result get a regular error response.
+func serveStream(ctx context.Context, w http.ResponseWriter, e endpoint.Endpoint, recv func() (interface{}, error), encode func(response interface{}) interface{}, errorHandler transport.ErrorHandler) {
+	var (
+		enc     = json.NewEncoder(w)
+		started = false
+	)
+	start := func() {
+		if !started {
+			w.Header().Set("Content-Type", mediaTypeNDJSON)
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+	}
+	send := func(response interface{}) error {
+		start()
+		if err := enc.Encode(streamLine{Result: encode(response)}); err != nil {
+			return err
+		}
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		return nil
+	}
+
+	response, err := e(ctx, addendpoint.Stream{Recv: recv, Send: send})
+	if f, ok := response.(endpoint.Failer); ok && err == nil {
+		err = f.Failed()
+	}
+	switch {
+	case err == nil:
+		start()
+	case !started:
+		errorHandler.Handle(ctx, err)
+		errorEncoder(ctx, err, w)
+	default:
+		errorHandler.Handle(ctx, err)
+		_, wrapper := wrapError(err)
+		enc.Encode(streamLine{errorWrapper: &wrapper})
+	}
+}
@@ -0,0 +1,282 @@
+package addtransport
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+)
+
+type object = map[string]interface{}
+
+// How an operation takes its request.
+type operationKind int
+
+const (
+	queryOrBody  operationKind = iota // query parameters on GET, a body on POST
+	bodyOnly                          // a body on POST
+	ndjsonStream                      // NDJSON lines on POST, answered in kind
+)
+
+// httpOperations lists the versioned routes of NewHTTPHandler for the
+// OpenAPI document.
+var httpOperations = []struct {
+	path     string
+	summary  string
+	request  reflect.Type
+	response reflect.Type
+	kind     operationKind
+}{
+	{"/v1/sum", "Add two integers", reflect.TypeOf(addendpoint.SumRequest{}), reflect.TypeOf(addendpoint.SumResponse{}), queryOrBody},
+	{"/v1/sum:decimal", "Add two integers written in decimal", reflect.TypeOf(addendpoint.SumDecimalRequest{}), reflect.TypeOf(addendpoint.SumDecimalResponse{}), queryOrBody},
+	{"/v1/concat", "Concatenate two strings", reflect.TypeOf(addendpoint.ConcatRequest{}), reflect.TypeOf(addendpoint.ConcatResponse{}), queryOrBody},
+	{"/v1/sum:batch", "Add many pairs of integers", reflect.TypeOf(addendpoint.BatchSumRequest{}), reflect.TypeOf(batchSumResult{}), bodyOnly},
+	{"/v1/sum:stream", "Add a stream of pairs of integers", reflect.TypeOf(addendpoint.SumRequest{}), reflect.TypeOf(sumResult{}), ndjsonStream},
+	{"/v1/batch", "Run operations of any method", reflect.TypeOf(addendpoint.BatchRequest{}), reflect.TypeOf(batchResult{}), bodyOnly},
+	{"/v1/eval", "Evaluate an expression over integers and strings", reflect.TypeOf(addendpoint.EvalRequest{}), reflect.TypeOf(addendpoint.EvalResponse{}), bodyOnly},
+}
+
+// ServeOpenAPI serves the OpenAPI 3 document of the HTTP API. The server URL
+// is taken from the request, so the document stays valid behind a prefix
+// like the gateway's /addsvc.
+func ServeOpenAPI(w http.ResponseWriter, r *http.Request) {
+	serveOpenAPI(w, r, func(string) bool { return true })
+}
+
+// OpenAPIHandler serves the document of ServeOpenAPI restricted to the
+// routes NewHTTPHandler serves with endpoints.
+func OpenAPIHandler(endpoints addendpoint.Set) http.Handler {
+	available := availablePaths(endpoints)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serveOpenAPI(w, r, func(path string) bool { return available[path] })
+	})
+}
+
+func serveOpenAPI(w http.ResponseWriter, r *http.Request, available func(path string) bool) {
+	base := strings.SplitN(r.RequestURI, "?", 2)[0]
+	base = strings.TrimSuffix(base, "/openapi.json")
+	if base == "" {
+		base = "/"
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(openAPIDocument(base, available))
+}
+
+func openAPIDocument(server string, available func(path string) bool) object {
+	errorSchema := schemaOf(reflect.TypeOf(errorWrapper{}))
+	errorSchema["properties"].(object)["reason"] = object{"type": "string", "enum": errorReasons()}
+	schemas := object{"Error": errorSchema}
+
+	paths := object{}
+	for _, op := range httpOperations {
+		if !available(op.path) {
+			continue
+		}
+		request, response := schemaName(op.request), schemaName(op.response)
+		schemas[request] = schemaOf(op.request)
+		schemas[response] = schemaOf(op.response)
+
+		responses := errorResponses()
+		responses["200"] = object{
+			"description": "Success",
+			"content":     bodyContent(response, op.response),
+		}
+		requestBody := object{"required": true, "content": bodyContent(request, op.request)}
+		if op.kind == ndjsonStream {
+			responses["200"] = object{
+				"description": "One line per request, and a last one with the error if the stream fails after the first result",
+				"content": object{mediaTypeNDJSON: object{"schema": object{
+					"type": "object",
+					"properties": object{
+						"result":    object{"$ref": "#/components/schemas/" + response},
+						"error":     object{"type": "string"},
+						"reason":    object{"type": "string"},
+						"retryable": object{"type": "boolean"},
+					},
+				}}},
+			}
+			requestBody["content"] = object{mediaTypeNDJSON: object{
+				"schema": object{"$ref": "#/components/schemas/" + request},
+			}}
+		}
+
+		id := operationID(op.path)
+		item := object{
+			"post": object{
+				"operationId": id,
+				"summary":     op.summary,
+				"requestBody": requestBody,
+				"responses":   responses,
+			},
+		}
+		if op.kind == queryOrBody {
+			var params []object
+			for _, f := range jsonFields(op.request) {
+				params = append(params, object{
+					"name":     f.name,
+					"in":       "query",
+					"required": !f.omitEmpty,
+					"schema":   schemaOf(f.typ),
+				})
+			}
+			item["get"] = object{
+				"operationId": id + "Query",
+				"summary":     op.summary,
+				"parameters":  params,
+				"responses":   responses,
+			}
+		}
+		paths[op.path] = item
+	}
+
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":   "addsvc",
+			"version": "v1",
+		},
+		"servers":    []object{{"url": server}},
+		"paths":      paths,
+		"components": object{"schemas": schemas},
+	}
+}
+
+// operationID turns a path like /v1/sum:batch into sumBatch.
+func operationID(path string) string {
+	parts := strings.Split(strings.TrimPrefix(path, "/v1/"), ":")
+	for i := 1; i < len(parts); i++ {
+		parts[i] = upperFirst(parts[i])
+	}
+	return strings.Join(parts, "")
+}
+
+// schemaName names the schema of t after it, also for the unexported types
+// of this package.
+func schemaName(t reflect.Type) string {
+	return upperFirst(t.Name())
+}
+
+func upperFirst(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// bodyContent offers schema, that of t, in every encoding that can hold it.
+// The protobuf encoding uses the messages of the gRPC API instead, and
+// google.rpc.Status for errors.
+func bodyContent(schema string, t reflect.Type) object {
+	content := object{}
+	for _, c := range codecs {
+		if !c.encodes(t) {
+			continue
+		}
+		content[c.mediaType] = object{
+			"schema": object{"$ref": "#/components/schemas/" + schema},
+		}
+	}
+	return content
+}
+
+// errorResponses documents every status code a registered error maps to,
+// along with its reasons.
+func errorResponses() object {
+	reasons := map[int][]string{}
+	for _, spec := range addservice.Errors() {
+		reasons[spec.HTTPStatus] = append(reasons[spec.HTTPStatus], spec.Reason)
+	}
+	responses := object{
+		"500": object{"description": "Unexpected error", "content": bodyContent("Error", reflect.TypeOf(errorWrapper{}))},
+	}
+	for code, rs := range reasons {
+		responses[strconv.Itoa(code)] = object{
+			"description": http.StatusText(code) + ": " + strings.Join(rs, ", "),
+			"content":     bodyContent("Error", reflect.TypeOf(errorWrapper{})),
+		}
+	}
+	return responses
+}
+
+func errorReasons() []string {
+	var reasons []string
+	for _, spec := range addservice.Errors() {
+		reasons = append(reasons, spec.Reason)
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+type jsonField struct {
+	index     int
+	name      string
+	typ       reflect.Type
+	omitEmpty bool
+}
+
+// jsonFields returns the fields of struct type t as encoding/json sees them.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+		name := tag[0]
+		if name == "" {
+			name = f.Name
+		}
+		omitEmpty := false
+		for _, opt := range tag[1:] {
+			omitEmpty = omitEmpty || opt == "omitempty"
+		}
+		fields = append(fields, jsonField{i, name, f.Type, omitEmpty})
+	}
+	return fields
+}
+
+func schemaOf(t reflect.Type) object {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Int32:
+		return object{"type": "integer", "format": "int32"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice:
+		return object{"type": "array", "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		properties := object{}
+		var required []string
+		for _, f := range jsonFields(t) {
+			properties[f.name] = schemaOf(f.typ)
+			if !f.omitEmpty {
+				required = append(required, f.name)
+			}
+		}
+		schema := object{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		return schema
+	default:
+		return object{}
+	}
+}
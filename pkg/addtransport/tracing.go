@@ -0,0 +1,140 @@
+package addtransport
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+)
+
+var propagator = propagation.NewCompositeTextMapPropagator(
+	propagation.TraceContext{},
+	propagation.Baggage{},
+)
+
+// metadataCarrier adapts gRPC metadata to the OpenTelemetry propagators.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// IdempotencyKeyHeader and idempotencyKeyMetadata carry the idempotency key
+// of a request, see addendpoint.IdempotencyMiddleware, over HTTP and gRPC,
+// and cacheControlHeader and cacheControlMetadata its
+// addservice.CacheControl.
+const (
+	IdempotencyKeyHeader   = "Idempotency-Key"
+	idempotencyKeyMetadata = "idempotency-key"
+	cacheControlHeader     = "Cache-Control"
+	cacheControlMetadata   = "cache-control"
+)
+
+// contextToGRPC and the functions below carry the trace, the idempotency
+// key and the cache control of a request between its context and the
+// transports.
+func contextToGRPC(ctx context.Context, md *metadata.MD) context.Context {
+	propagator.Inject(ctx, metadataCarrier(*md))
+	if key := addservice.IdempotencyKey(ctx); key != "" {
+		md.Set(idempotencyKeyMetadata, key)
+	}
+	if cc := addservice.CacheControlFrom(ctx).String(); cc != "" {
+		md.Set(cacheControlMetadata, cc)
+	}
+	return ctx
+}
+
+func grpcToContext(ctx context.Context, md metadata.MD) context.Context {
+	if v := md.Get(idempotencyKeyMetadata); len(v) > 0 {
+		ctx = addservice.WithIdempotencyKey(ctx, v[0])
+	}
+	if v := md.Get(cacheControlMetadata); len(v) > 0 {
+		ctx = addservice.WithCacheControl(ctx, addservice.ParseCacheControl(strings.Join(v, ",")))
+	}
+	return propagator.Extract(ctx, metadataCarrier(md))
+}
+
+func contextToHTTP(ctx context.Context, r *http.Request) context.Context {
+	propagator.Inject(ctx, propagation.HeaderCarrier(r.Header))
+	if key := addservice.IdempotencyKey(ctx); key != "" {
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+	if cc := addservice.CacheControlFrom(ctx).String(); cc != "" {
+		r.Header.Set(cacheControlHeader, cc)
+	}
+	return ctx
+}
+
+// httpToContext only takes the idempotency key and the cache control,
+// tracingHandler takes the trace.
+func httpToContext(ctx context.Context, r *http.Request) context.Context {
+	if key := r.Header.Get(IdempotencyKeyHeader); key != "" {
+		ctx = addservice.WithIdempotencyKey(ctx, key)
+	}
+	if v := r.Header.Values(cacheControlHeader); len(v) > 0 {
+		ctx = addservice.WithCacheControl(ctx, addservice.ParseCacheControl(strings.Join(v, ",")))
+	}
+	return ctx
+}
+
+// tracingHandler starts a server span for every request, continuing the
+// trace of the caller if it sent one.
+func tracingHandler(tracer trace.Tracer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.RequestURI()),
+			),
+		)
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttributes(attribute.Int("http.status_code", sw.status))
+		if sw.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(sw.status))
+		}
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps streamed responses flowing through the wrapper.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
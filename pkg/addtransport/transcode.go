@@ -0,0 +1,489 @@
+package addtransport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/go-kit/kit/transport"
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// MethodResponse is the response of the endpoints made by
+// NewGRPCMethodClient. Err holds business errors, as in the responses of the
+// addendpoint package.
+type MethodResponse struct {
+	Message proto.Message
+	Err     error
+}
+
+func (r MethodResponse) Failed() error { return r.Err }
+
+// NewGRPCMethodClient returns an endpoint calling method on conn, for any
+// method of any service. It takes a proto.Message of the method's input type
+// and returns a MethodResponse, wrapped in the same middlewares as the
+// endpoints of NewGRPCClient. Streaming methods get a streaming endpoint
+// instead, see addendpoint.Stream, whose Recv yields input messages and whose
+// Send takes output messages.
+func NewGRPCMethodClient(conn *grpc.ClientConn, method protoreflect.MethodDescriptor, cfg ClientConfig, stateChanges, rejections metrics.Counter) endpoint.Endpoint {
+	var (
+		name       = string(method.Name())
+		fullMethod = fmt.Sprintf("/%s/%s", method.Parent().FullName(), method.Name())
+	)
+	var e endpoint.Endpoint
+	{
+		e = func(ctx context.Context, request interface{}) (interface{}, error) {
+			md := metadata.Pairs(errorModeKey, errorModeStatus)
+			ctx = contextToGRPC(ctx, &md)
+			ctx = metadata.NewOutgoingContext(ctx, md)
+
+			if s, ok := request.(addendpoint.Stream); ok {
+				return nil, invokeStream(ctx, conn, method, fullMethod, s)
+			}
+			reply := dynamicpb.NewMessage(method.Output())
+			if err := conn.Invoke(ctx, fullMethod, request, reply); err != nil {
+				return nil, err
+			}
+			return MethodResponse{Message: reply}, nil
+		}
+		e = statusErrorMiddleware(func(err error) interface{} {
+			return MethodResponse{Err: err}
+		})(e)
+		e = ratelimit.NewErroringLimiter(cfg.RateLimit.NewLimiter())(e)
+		e = addendpoint.RejectionMiddleware(rejections.With("method", name))(e)
+		e = cfg.circuitBreaker(name, stateChanges)(e)
+	}
+	return e
+}
+
+// invokeStream forwards the requests of s to a new stream of method on conn
+// while handing its responses to s, until either side is done. A failing
+// Recv closes the sending side, so that the results of the requests already
+// sent still reach s before the error is returned.
+func invokeStream(ctx context.Context, conn *grpc.ClientConn, method protoreflect.MethodDescriptor, fullMethod string, s addendpoint.Stream) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	cs, err := conn.NewStream(ctx, &grpc.StreamDesc{
+		StreamName:    string(method.Name()),
+		ClientStreams: method.IsStreamingClient(),
+		ServerStreams: method.IsStreamingServer(),
+	}, fullMethod)
+	if err != nil {
+		return err
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		for {
+			req, err := s.Recv()
+			if err != nil {
+				cs.CloseSend()
+				if err == io.EOF {
+					err = nil
+				}
+				sent <- err
+				return
+			}
+			if err := cs.SendMsg(req); err != nil {
+				// The reason is reported by RecvMsg.
+				sent <- nil
+				return
+			}
+		}
+	}()
+
+	// On failure the sending goroutine is left to notice the canceled
+	// stream by itself, as it may be blocked in Recv.
+	for {
+		reply := dynamicpb.NewMessage(method.Output())
+		if err := cs.RecvMsg(reply); err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if err := s.Send(reply); err != nil {
+			return err
+		}
+	}
+	return <-sent
+}
+
+// NewTranscodingHandler serves every method of service that carries a
+// google.api.http annotation, translating HTTP requests into requests for
+// the method's endpoint, keyed by the method's full name, and the endpoint's
+// MethodResponse back. Bodies can be JSON, protobuf, MessagePack or forms,
+// responses JSON, protobuf or MessagePack.
+func NewTranscodingHandler(service protoreflect.ServiceDescriptor, endpoints map[protoreflect.FullName]endpoint.Endpoint, logger log.Logger, tracer trace.Tracer) http.Handler {
+	options := []httptransport.ServerOption{
+		httptransport.ServerErrorEncoder(errorEncoder),
+		httptransport.ServerErrorHandler(transport.NewLogErrorHandler(logger)),
+		httptransport.ServerBefore(negotiateResponseCodec, httpToContext),
+	}
+
+	r := mux.NewRouter()
+	methods := service.Methods()
+	for i := 0; i < methods.Len(); i++ {
+		method := methods.Get(i)
+		e, ok := endpoints[method.FullName()]
+		if !ok {
+			continue
+		}
+		for _, b := range httpBindings(method) {
+			route := r.Path(b.path)
+			if b.verb != "*" {
+				route = route.Methods(b.verb)
+			}
+			if method.IsStreamingClient() || method.IsStreamingServer() {
+				route.Handler(transcodedStreamHandler(method, b, e, logger))
+				continue
+			}
+			route.Handler(httptransport.NewServer(
+				e,
+				decodeTranscodedRequest(method, b),
+				encodeTranscodedResponse,
+				options...,
+			))
+		}
+	}
+	return tracingHandler(tracer, r)
+}
+
+// transcodedStreamHandler serves a streaming method as NDJSON. Methods with
+// a single request take it like unary ones.
+func transcodedStreamHandler(method protoreflect.MethodDescriptor, b httpBinding, e endpoint.Endpoint, logger log.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var recv func() (interface{}, error)
+		if method.IsStreamingClient() {
+			var err error
+			recv, err = ndjsonRecv(r, func(line []byte) (interface{}, error) {
+				msg := dynamicpb.NewMessage(method.Input())
+				err := protojson.Unmarshal(line, msg)
+				return msg, err
+			})
+			if err != nil {
+				errorEncoder(r.Context(), err, w)
+				return
+			}
+		} else {
+			req, err := decodeTranscodedRequest(method, b)(r.Context(), r)
+			if err != nil {
+				errorEncoder(r.Context(), err, w)
+				return
+			}
+			done := false
+			recv = func() (interface{}, error) {
+				if done {
+					return nil, io.EOF
+				}
+				done = true
+				return req, nil
+			}
+		}
+		serveStream(r.Context(), w, e, recv, func(response interface{}) interface{} {
+			return messageToMap(response.(proto.Message).ProtoReflect())
+		}, transport.NewLogErrorHandler(logger))
+	})
+}
+
+type httpBinding struct {
+	verb string
+	path string
+	body string
+}
+
+// httpBindings returns the bindings of the google.api.http annotation of
+// method, including the additional ones.
+func httpBindings(method protoreflect.MethodDescriptor) []httpBinding {
+	rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return nil
+	}
+	var bindings []httpBinding
+	for _, rule := range append([]*annotations.HttpRule{rule}, rule.AdditionalBindings...) {
+		b := httpBinding{body: rule.Body}
+		switch p := rule.Pattern.(type) {
+		case *annotations.HttpRule_Get:
+			b.verb, b.path = http.MethodGet, p.Get
+		case *annotations.HttpRule_Put:
+			b.verb, b.path = http.MethodPut, p.Put
+		case *annotations.HttpRule_Post:
+			b.verb, b.path = http.MethodPost, p.Post
+		case *annotations.HttpRule_Delete:
+			b.verb, b.path = http.MethodDelete, p.Delete
+		case *annotations.HttpRule_Patch:
+			b.verb, b.path = http.MethodPatch, p.Patch
+		case *annotations.HttpRule_Custom:
+			b.verb, b.path = p.Custom.Kind, p.Custom.Path
+		default:
+			continue
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings
+}
+
+// decodeTranscodedRequest fills a message of the method's input type from,
+// in order, the body as described by the binding, the path variables and the
+// query parameters.
+func decodeTranscodedRequest(method protoreflect.MethodDescriptor, b httpBinding) httptransport.DecodeRequestFunc {
+	return func(_ context.Context, r *http.Request) (interface{}, error) {
+		msg := dynamicpb.NewMessage(method.Input())
+		if b.body != "" {
+			target := msg.ProtoReflect()
+			if b.body != "*" {
+				fd := target.Descriptor().Fields().ByName(protoreflect.Name(b.body))
+				if fd == nil || fd.Message() == nil {
+					return nil, fmt.Errorf("body field %q is not a message field of %s", b.body, method.Input().FullName())
+				}
+				target = target.Mutable(fd).Message()
+			}
+			if err := decodeMessageBody(r, target); err != nil {
+				return nil, err
+			}
+		}
+		for name, value := range mux.Vars(r) {
+			if err := setField(msg, name, []string{value}); err != nil {
+				return nil, invalidRequest("path: %v", err)
+			}
+		}
+		query, err := url.ParseQuery(r.URL.RawQuery)
+		if err != nil {
+			return nil, invalidRequest("query: %v", err)
+		}
+		for name, values := range query {
+			if err := setField(msg, name, values); err != nil {
+				return nil, invalidRequest("query: %v", err)
+			}
+		}
+		return msg, nil
+	}
+}
+
+func decodeMessageBody(r *http.Request, m protoreflect.Message) error {
+	c, err := contentCodec(r.Header)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return invalidRequest("body: %v", err)
+	}
+	switch c.mediaType {
+	case mediaTypeProtobuf:
+		err = proto.Unmarshal(data, m.Interface())
+		if err == nil && len(m.GetUnknown()) > 0 {
+			err = fmt.Errorf("unknown fields in protobuf message")
+		}
+	case mediaTypeForm:
+		var values url.Values
+		if values, err = url.ParseQuery(string(data)); err == nil {
+			for name, vs := range values {
+				if err = setField(m.Interface(), name, vs); err != nil {
+					break
+				}
+			}
+		}
+	case mediaTypeMsgpack:
+		var v interface{}
+		if err = msgpack.Unmarshal(data, &v); err == nil {
+			if data, err = json.Marshal(v); err == nil {
+				err = protojson.Unmarshal(data, m.Interface())
+			}
+		}
+	default:
+		err = protojson.Unmarshal(data, m.Interface())
+	}
+	if err != nil {
+		return invalidRequest("body: %v", err)
+	}
+	return nil
+}
+
+// setField sets the scalar field at the dotted path name, given by proto or
+// JSON names, from its string representation.
+func setField(msg proto.Message, name string, values []string) error {
+	m := msg.ProtoReflect()
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		fields := m.Descriptor().Fields()
+		fd := fields.ByName(protoreflect.Name(part))
+		if fd == nil {
+			fd = fields.ByJSONName(part)
+		}
+		if fd == nil {
+			return fmt.Errorf("unknown field %q", name)
+		}
+		if i < len(parts)-1 {
+			if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+				return fmt.Errorf("%s: %s is not a message field", name, part)
+			}
+			m = m.Mutable(fd).Message()
+			continue
+		}
+		if fd.IsMap() || (fd.Message() != nil && !fd.IsList()) {
+			return fmt.Errorf("%s: not a scalar field", name)
+		}
+		if !fd.IsList() {
+			if len(values) > 1 {
+				return fmt.Errorf("%s given more than once", name)
+			}
+			v, err := parseScalar(fd, values[0])
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			m.Set(fd, v)
+			return nil
+		}
+		list := m.Mutable(fd).List()
+		for _, s := range values {
+			v, err := parseScalar(fd, s)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			list.Append(v)
+		}
+	}
+	return nil
+}
+
+func parseScalar(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(s)), nil
+	case protoreflect.BoolKind:
+		b, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(b), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		n, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(n)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		n, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(n), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		n, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(n)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		n, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(n), err
+	case protoreflect.FloatKind:
+		f, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(f)), err
+	case protoreflect.DoubleKind:
+		f, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(f), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		n, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(n)), err
+	default:
+		return protoreflect.Value{}, fmt.Errorf("unsupported kind %s", fd.Kind())
+	}
+}
+
+func encodeTranscodedResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp := response.(MethodResponse)
+	if resp.Err != nil {
+		errorEncoder(ctx, resp.Err, w)
+		return nil
+	}
+	var (
+		c    = responseCodec(ctx)
+		body []byte
+		err  error
+	)
+	switch c.mediaType {
+	case mediaTypeProtobuf:
+		body, err = proto.Marshal(resp.Message)
+	case mediaTypeMsgpack:
+		body, err = msgpack.Marshal(messageToMap(resp.Message.ProtoReflect()))
+	default:
+		c = codecs[0]
+		body, err = json.Marshal(messageToMap(resp.Message.ProtoReflect()))
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", c.contentType())
+	w.Header().Set("Vary", "Accept")
+	_, err = w.Write(body)
+	return err
+}
+
+// messageToMap converts m into the shape of the hand-written JSON API:
+// every field under its JSON name, numbers as numbers, and deprecated
+// fields as well as unset optional ones left out.
+func messageToMap(m protoreflect.Message) map[string]interface{} {
+	out := map[string]interface{}{}
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if opts, ok := fd.Options().(*descriptorpb.FieldOptions); ok && opts.GetDeprecated() {
+			continue
+		}
+		if fd.HasPresence() && !m.Has(fd) {
+			continue
+		}
+		out[fd.JSONName()] = fieldValue(fd, m.Get(fd))
+	}
+	return out
+}
+
+func fieldValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		values := make([]interface{}, list.Len())
+		for i := range values {
+			values[i] = singularValue(fd, list.Get(i))
+		}
+		return values
+	case fd.IsMap():
+		values := map[string]interface{}{}
+		v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			values[k.String()] = singularValue(fd.MapValue(), v)
+			return true
+		})
+		return values
+	default:
+		return singularValue(fd, v)
+	}
+}
+
+func singularValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return messageToMap(v.Message())
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByNumber(v.Enum()); ev != nil {
+			return string(ev.Name())
+		}
+		return int32(v.Enum())
+	default:
+		return v.Interface()
+	}
+}
@@ -0,0 +1,161 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Validator is implemented by the configuration structs of the binaries.
+type Validator interface {
+	Validate() error
+}
+
+// Load fills cfg from, in increasing order of precedence, its current
+// (default) values, the YAML or JSON file at *path, environment variables
+// and the flags of fs that are set in args. The flags of fs are expected to
+// point into cfg, and path to be one of them.
+//
+// Environment variables are named after the YAML keys leading to a field,
+// upper-cased, joined by underscores and prefixed by prefix, so the field
+// at "health.interval" of prefix "ADDSVC" is set by ADDSVC_HEALTH_INTERVAL.
+func Load(fs *flag.FlagSet, args []string, path *string, prefix string, cfg Validator) error {
+	// Parse twice: first to learn the file path, then to let the flags win
+	// over file and environment.
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *path != "" {
+		if err := ReadFile(*path, cfg); err != nil {
+			return err
+		}
+	}
+	if err := FromEnv(prefix, cfg); err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	return cfg.Validate()
+}
+
+// ReadFile decodes the YAML or JSON file at path over cfg. Keys missing from
+// the file leave the corresponding fields untouched.
+func ReadFile(path string, cfg interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	// YAML is a superset of JSON, so this covers both formats.
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// FromEnv overrides the fields of the struct cfg points to with the
+// environment variables named as described for Load.
+func FromEnv(prefix string, cfg interface{}) error {
+	return fromEnv(prefix, reflect.ValueOf(cfg).Elem())
+}
+
+func fromEnv(prefix string, v reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		key := prefix + "_" + strings.ToUpper(name)
+		field := v.Field(i)
+		if field.Kind() == reflect.Struct {
+			if err := fromEnv(key, field); err != nil {
+				return err
+			}
+			continue
+		}
+		s, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setString(field, s); err != nil {
+			return fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+func setString(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.String:
+		v.Set(reflect.ValueOf(SplitList(s)))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// SplitList splits a comma separated list, dropping empty elements.
+func SplitList(s string) []string {
+	var list []string
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			list = append(list, e)
+		}
+	}
+	return list
+}
+
+type listValue struct{ p *[]string }
+
+func (l listValue) String() string {
+	if l.p == nil {
+		return ""
+	}
+	return strings.Join(*l.p, ",")
+}
+
+func (l listValue) Set(s string) error {
+	*l.p = SplitList(s)
+	return nil
+}
+
+// ListVar defines a comma separated list flag backed by p.
+func ListVar(fs *flag.FlagSet, p *[]string, name, usage string) {
+	fs.Var(listValue{p}, name, usage)
+}
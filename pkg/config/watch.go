@@ -0,0 +1,54 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const watchInterval = 2 * time.Second
+
+// Watch calls reload whenever the file at path changes and whenever the
+// process receives SIGHUP, until ctx is done. With an empty path it only
+// reacts to SIGHUP.
+func Watch(ctx context.Context, path string, reload func()) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	t := time.NewTicker(watchInterval)
+	defer t.Stop()
+
+	last := stat(path)
+	for {
+		select {
+		case <-hup:
+			reload()
+		case <-t.C:
+			if path == "" {
+				continue
+			}
+			if cur := stat(path); cur != last {
+				last = cur
+				reload()
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func stat(path string) fileState {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{fi.ModTime(), fi.Size()}
+}
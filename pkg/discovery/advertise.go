@@ -0,0 +1,55 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+)
+
+// AdvertiseAddr decides which address a service registers under. An explicit
+// addr always wins. Otherwise the first IPv4 address of iface is used, or,
+// without iface, the first IPv4 address of any interface that is up and not
+// a loopback.
+func AdvertiseAddr(addr, iface string) (string, error) {
+	if addr != "" {
+		return addr, nil
+	}
+	if iface != "" {
+		i, err := net.InterfaceByName(iface)
+		if err != nil {
+			return "", err
+		}
+		if ip := firstIPv4(i); ip != nil {
+			return ip.String(), nil
+		}
+		return "", fmt.Errorf("interface %s has no IPv4 address", iface)
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, i := range ifaces {
+		if i.Flags&net.FlagUp == 0 || i.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if ip := firstIPv4(&i); ip != nil {
+			return ip.String(), nil
+		}
+	}
+	return "", fmt.Errorf("no usable interface found, set an advertise address")
+}
+
+func firstIPv4(iface *net.Interface) net.IP {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			if ip := ipnet.IP.To4(); ip != nil && !ip.IsLinkLocalUnicast() {
+				return ip
+			}
+		}
+	}
+	return nil
+}
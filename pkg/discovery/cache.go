@@ -0,0 +1,69 @@
+package discovery
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/go-kit/kit/sd"
+)
+
+// cache keeps the last known state of a service and broadcasts every change
+// to the registered channels, as sd.Instancer implementations must.
+type cache struct {
+	mtx      sync.RWMutex
+	state    sd.Event
+	registry map[chan<- sd.Event]struct{}
+}
+
+func newCache() *cache {
+	return &cache{registry: map[chan<- sd.Event]struct{}{}}
+}
+
+func (c *cache) Update(event sd.Event) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	sort.Strings(event.Instances)
+	if event.Err == nil && c.state.Err == nil && equal(event.Instances, c.state.Instances) {
+		return
+	}
+	if event.Err != nil {
+		// Keep the last known instances around, like the go-kit instancers do.
+		event.Instances = c.state.Instances
+	}
+	c.state = event
+	for ch := range c.registry {
+		ch <- c.state
+	}
+}
+
+func (c *cache) State() sd.Event {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	return c.state
+}
+
+func (c *cache) Register(ch chan<- sd.Event) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.registry[ch] = struct{}{}
+	ch <- c.state
+}
+
+func (c *cache) Deregister(ch chan<- sd.Event) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	delete(c.registry, ch)
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,59 @@
+package discovery
+
+import (
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	consulsd "github.com/go-kit/kit/sd/consul"
+	"github.com/hashicorp/consul/api"
+)
+
+type consulBackend struct {
+	client consulsd.Client
+	logger log.Logger
+}
+
+// newConsulBackend talks to the Consul agent at target, or to the one
+// configured through the usual CONSUL_* environment variables.
+func newConsulBackend(target string, logger log.Logger) (Backend, error) {
+	config := api.DefaultConfig()
+	if target != "" {
+		config.Address = target
+	}
+	client, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+	return consulBackend{consulsd.NewClient(client), logger}, nil
+}
+
+func (b consulBackend) Instancer(service string, tags []string) (sd.Instancer, error) {
+	passingOnly := true
+	return consulsd.NewInstancer(b.client, b.logger, service, tags, passingOnly), nil
+}
+
+func (b consulBackend) Registrar(r Registration) (sd.Registrar, error) {
+	var checks api.AgentServiceChecks
+	if r.HealthHTTP != "" {
+		checks = append(checks, &api.AgentServiceCheck{
+			Interval: "5s",
+			Timeout:  "2s",
+			HTTP:     r.HealthHTTP,
+		})
+	}
+	if r.HealthGRPC != "" {
+		checks = append(checks, &api.AgentServiceCheck{
+			Interval: "5s",
+			Timeout:  "2s",
+			GRPC:     r.HealthGRPC,
+		})
+	}
+	return consulsd.NewRegistrar(b.client, &api.AgentServiceRegistration{
+		ID:      r.ID,
+		Name:    r.Name,
+		Port:    r.Port,
+		Address: r.Address,
+		Tags:    r.Tags,
+		Meta:    r.Meta,
+		Checks:  checks,
+	}, b.logger), nil
+}
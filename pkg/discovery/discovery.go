@@ -0,0 +1,107 @@
+package discovery
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+)
+
+// Backend is a service discovery system. Instancer is used by clients to
+// find the instances of a service that carry all of tags, Registrar by a
+// service to announce itself.
+type Backend interface {
+	Instancer(service string, tags []string) (sd.Instancer, error)
+	Registrar(r Registration) (sd.Registrar, error)
+}
+
+// Registration describes a service instance. HealthHTTP is the URL of its
+// HTTP health endpoint, HealthGRPC the "host:port/service" target of its
+// gRPC health service; backends that cannot check health ignore them.
+type Registration struct {
+	ID         string
+	Name       string
+	Address    string
+	Port       int
+	Tags       []string
+	Meta       map[string]string
+	HealthHTTP string
+	HealthGRPC string
+}
+
+func hasTags(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Factory builds a backend. target is backend specific, see the flag
+// documentation of the commands for the built-in backends.
+type Factory func(target string, logger log.Logger) (Backend, error)
+
+var backends = struct {
+	sync.RWMutex
+	m map[string]Factory
+}{
+	m: map[string]Factory{
+		"consul":   newConsulBackend,
+		"static":   newStaticBackend,
+		"file":     newFileBackend,
+		"dnssrv":   newDNSSRVBackend,
+		"registry": newRegistryBackend,
+	},
+}
+
+// Register makes a backend available to New by name.
+func Register(name string, factory Factory) {
+	backends.Lock()
+	defer backends.Unlock()
+	backends.m[name] = factory
+}
+
+// Backends returns the names of all registered backends.
+func Backends() []string {
+	backends.RLock()
+	defer backends.RUnlock()
+	names := make([]string, 0, len(backends.m))
+	for name := range backends.m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// New returns the backend registered under name.
+func New(name, target string, logger log.Logger) (Backend, error) {
+	backends.RLock()
+	factory, ok := backends.m[name]
+	backends.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown discovery backend %q", name)
+	}
+	return factory(target, log.With(logger, "discovery", name))
+}
+
+// nopRegistrar is used by backends where instances are not registered by the
+// services themselves, e.g. a static list or DNS.
+type nopRegistrar struct {
+	logger log.Logger
+}
+
+func (r nopRegistrar) Register() {
+	r.logger.Log("action", "register", "result", "skipped, backend is not writable")
+}
+
+func (r nopRegistrar) Deregister() {}
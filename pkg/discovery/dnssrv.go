@@ -0,0 +1,35 @@
+package discovery
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"github.com/go-kit/kit/sd/dnssrv"
+)
+
+const dnsTTL = 30 * time.Second
+
+type dnssrvBackend struct {
+	domain string
+	logger log.Logger
+}
+
+// newDNSSRVBackend resolves _service._tcp.target. With an empty target the
+// service name itself is looked up. DNS has no notion of tags, so they are
+// ignored.
+func newDNSSRVBackend(target string, logger log.Logger) (Backend, error) {
+	return dnssrvBackend{target, logger}, nil
+}
+
+func (b dnssrvBackend) Instancer(service string, _ []string) (sd.Instancer, error) {
+	name := service
+	if b.domain != "" {
+		name = "_" + service + "._tcp." + b.domain
+	}
+	return dnssrv.NewInstancer(name, dnsTTL, b.logger), nil
+}
+
+func (b dnssrvBackend) Registrar(Registration) (sd.Registrar, error) {
+	return nopRegistrar{b.logger}, nil
+}
@@ -0,0 +1,141 @@
+package discovery
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"gopkg.in/yaml.v2"
+)
+
+const filePollInterval = 2 * time.Second
+
+type fileBackend struct {
+	path   string
+	logger log.Logger
+}
+
+// newFileBackend reads instances from the JSON or YAML file at target and
+// picks up changes while running. The file maps service names to lists of
+// instances, each either a plain "host:port" string, which matches any tags,
+// or an object with "addr" and "tags" keys.
+//
+//	addsvc:
+//	  - localhost:9091
+//	  - addr: localhost:8082
+//	    tags: [http]
+func newFileBackend(target string, logger log.Logger) (Backend, error) {
+	if target == "" {
+		return nil, errors.New("file discovery needs a path")
+	}
+	if _, err := readInstanceFile(target); err != nil {
+		return nil, err
+	}
+	return fileBackend{target, logger}, nil
+}
+
+func (b fileBackend) Instancer(service string, tags []string) (sd.Instancer, error) {
+	return newFileInstancer(b.path, service, tags, filePollInterval, b.logger), nil
+}
+
+func (b fileBackend) Registrar(Registration) (sd.Registrar, error) {
+	return nopRegistrar{b.logger}, nil
+}
+
+type fileInstance struct {
+	Addr string   `yaml:"addr"`
+	Tags []string `yaml:"tags"`
+}
+
+func (fi *fileInstance) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if err := unmarshal(&fi.Addr); err == nil {
+		fi.Tags = nil
+		return nil
+	}
+	type plain fileInstance
+	return unmarshal((*plain)(fi))
+}
+
+func readInstanceFile(path string) (map[string][]fileInstance, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// YAML is a superset of JSON, so this covers both formats.
+	var services map[string][]fileInstance
+	if err := yaml.Unmarshal(data, &services); err != nil {
+		return nil, err
+	}
+	return services, nil
+}
+
+type fileInstancer struct {
+	*cache
+	path    string
+	service string
+	tags    []string
+	logger  log.Logger
+	quit    chan struct{}
+}
+
+func newFileInstancer(path, service string, tags []string, interval time.Duration, logger log.Logger) *fileInstancer {
+	fi := &fileInstancer{
+		cache:   newCache(),
+		path:    path,
+		service: service,
+		tags:    tags,
+		logger:  log.With(logger, "path", path, "service", service),
+		quit:    make(chan struct{}),
+	}
+	modTime := fi.reload()
+	go fi.loop(interval, modTime)
+	return fi
+}
+
+func (fi *fileInstancer) loop(interval time.Duration, modTime time.Time) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			info, err := os.Stat(fi.path)
+			if err != nil {
+				fi.logger.Log("err", err)
+				fi.Update(sd.Event{Err: err})
+				continue
+			}
+			if !info.ModTime().Equal(modTime) {
+				modTime = fi.reload()
+			}
+		case <-fi.quit:
+			return
+		}
+	}
+}
+
+func (fi *fileInstancer) reload() time.Time {
+	var modTime time.Time
+	if info, err := os.Stat(fi.path); err == nil {
+		modTime = info.ModTime()
+	}
+	services, err := readInstanceFile(fi.path)
+	if err != nil {
+		fi.logger.Log("err", err)
+		fi.Update(sd.Event{Err: err})
+		return modTime
+	}
+	var instances []string
+	for _, in := range services[fi.service] {
+		if in.Tags == nil || hasTags(in.Tags, fi.tags) {
+			instances = append(instances, in.Addr)
+		}
+	}
+	fi.Update(sd.Event{Instances: instances})
+	return modTime
+}
+
+func (fi *fileInstancer) Stop() {
+	close(fi.quit)
+}
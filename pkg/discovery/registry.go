@@ -0,0 +1,196 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+	"github.com/maolonglong/microservices-example/pkg/registry"
+)
+
+const (
+	registryWait    = 30 * time.Second
+	registryBackoff = time.Second
+	registryTimeout = 5 * time.Second
+)
+
+type registryBackend struct {
+	client *registry.Client
+	logger log.Logger
+}
+
+// newRegistryBackend uses the registry of cmd/registry listening at target.
+func newRegistryBackend(target string, logger log.Logger) (Backend, error) {
+	if target == "" {
+		target = "localhost:8400"
+	}
+	client, err := registry.NewClient(target)
+	if err != nil {
+		return nil, err
+	}
+	return registryBackend{client, logger}, nil
+}
+
+func (b registryBackend) Instancer(service string, tags []string) (sd.Instancer, error) {
+	return newRegistryInstancer(b.client, service, tags, b.logger), nil
+}
+
+func (b registryBackend) Registrar(r Registration) (sd.Registrar, error) {
+	return newRegistryRegistrar(b.client, registry.Instance{
+		ID:         r.ID,
+		Service:    r.Name,
+		Address:    r.Address,
+		Port:       r.Port,
+		Tags:       r.Tags,
+		Meta:       r.Meta,
+		TTLSeconds: int(registry.DefaultTTL / time.Second),
+		HealthHTTP: r.HealthHTTP,
+		HealthGRPC: r.HealthGRPC,
+	}, b.logger), nil
+}
+
+// registryInstancer keeps a blocking watch open on the registry and
+// publishes every change.
+type registryInstancer struct {
+	*cache
+	client  *registry.Client
+	service string
+	tags    []string
+	logger  log.Logger
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+func newRegistryInstancer(client *registry.Client, service string, tags []string, logger log.Logger) *registryInstancer {
+	ctx, cancel := context.WithCancel(context.Background())
+	ri := &registryInstancer{
+		cache:   newCache(),
+		client:  client,
+		service: service,
+		tags:    tags,
+		logger:  log.With(logger, "service", service),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	go ri.loop()
+	return ri
+}
+
+func (ri *registryInstancer) loop() {
+	var index uint64
+	for {
+		snapshot, err := ri.client.Watch(ri.ctx, ri.service, ri.tags, index, registryWait)
+		switch {
+		case ri.ctx.Err() != nil:
+			return
+		case err != nil:
+			ri.logger.Log("err", err)
+			ri.Update(sd.Event{Err: err})
+			index = 0
+			select {
+			case <-time.After(registryBackoff):
+			case <-ri.ctx.Done():
+				return
+			}
+		default:
+			index = snapshot.Index
+			instances := make([]string, 0, len(snapshot.Instances))
+			for _, in := range snapshot.Instances {
+				instances = append(instances, net.JoinHostPort(in.Address, strconv.Itoa(in.Port)))
+			}
+			ri.Update(sd.Event{Instances: instances})
+		}
+	}
+}
+
+func (ri *registryInstancer) Stop() {
+	ri.cancel()
+}
+
+// registryRegistrar registers an instance and keeps it alive with
+// heartbeats. If the registry forgot about it, e.g. after a restart, the
+// instance is registered again.
+type registryRegistrar struct {
+	client   *registry.Client
+	instance registry.Instance
+	logger   log.Logger
+
+	mtx  sync.Mutex
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newRegistryRegistrar(client *registry.Client, instance registry.Instance, logger log.Logger) *registryRegistrar {
+	return &registryRegistrar{
+		client:   client,
+		instance: instance,
+		logger:   log.With(logger, "service", instance.Service, "id", instance.ID),
+	}
+}
+
+func (r *registryRegistrar) Register() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if err := r.register(); err != nil {
+		r.logger.Log("action", "register", "err", err)
+	} else {
+		r.logger.Log("action", "register")
+	}
+	if r.stop == nil {
+		r.stop, r.done = make(chan struct{}), make(chan struct{})
+		go r.heartbeat(r.stop, r.done)
+	}
+}
+
+func (r *registryRegistrar) Deregister() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	if r.stop != nil {
+		close(r.stop)
+		<-r.done
+		r.stop, r.done = nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	if err := r.client.Deregister(ctx, r.instance.ID); err != nil {
+		r.logger.Log("action", "deregister", "err", err)
+	} else {
+		r.logger.Log("action", "deregister")
+	}
+}
+
+func (r *registryRegistrar) register() error {
+	ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+	defer cancel()
+	return r.client.Register(ctx, r.instance)
+}
+
+func (r *registryRegistrar) heartbeat(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	t := time.NewTicker(r.instance.TTL() / 3)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), registryTimeout)
+			err := r.client.Heartbeat(ctx, r.instance.ID)
+			cancel()
+			if errors.Is(err, registry.ErrNotFound) {
+				err = r.register()
+			}
+			if err != nil {
+				r.logger.Log("action", "heartbeat", "err", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
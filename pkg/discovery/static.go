@@ -0,0 +1,53 @@
+package discovery
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+)
+
+type staticBackend struct {
+	instances []fileInstance
+	logger    log.Logger
+}
+
+// newStaticBackend serves the comma separated instances in target for every
+// service. An instance is "host:port", which matches any tags, optionally
+// followed by tags each introduced by "#", e.g. "localhost:9091#grpc". target
+// may be empty for services that only register, which is a no-op here.
+func newStaticBackend(target string, logger log.Logger) (Backend, error) {
+	var instances []fileInstance
+	for _, instance := range strings.Split(target, ",") {
+		if instance = strings.TrimSpace(instance); instance == "" {
+			continue
+		}
+		parts := strings.Split(instance, "#")
+		fi := fileInstance{Addr: parts[0]}
+		for _, tag := range parts[1:] {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				fi.Tags = append(fi.Tags, tag)
+			}
+		}
+		instances = append(instances, fi)
+	}
+	return staticBackend{instances, logger}, nil
+}
+
+func (b staticBackend) Instancer(_ string, tags []string) (sd.Instancer, error) {
+	if len(b.instances) == 0 {
+		return nil, errors.New("static discovery needs at least one instance")
+	}
+	var instances []string
+	for _, fi := range b.instances {
+		if fi.Tags == nil || hasTags(fi.Tags, tags) {
+			instances = append(instances, fi.Addr)
+		}
+	}
+	return sd.FixedInstancer(instances), nil
+}
+
+func (b staticBackend) Registrar(Registration) (sd.Registrar, error) {
+	return nopRegistrar{b.logger}, nil
+}
@@ -0,0 +1,51 @@
+package discovery
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/go-kit/kit/log"
+	"github.com/go-kit/kit/sd"
+)
+
+func TestStaticBackend(t *testing.T) {
+	const target = "localhost:9091#grpc, localhost:8081#http#v2,localhost:9999"
+	for _, tc := range []struct {
+		tags []string
+		want []string
+	}{
+		{nil, []string{"localhost:9091", "localhost:8081", "localhost:9999"}},
+		{[]string{"grpc"}, []string{"localhost:9091", "localhost:9999"}},
+		{[]string{"http", "v2"}, []string{"localhost:8081", "localhost:9999"}},
+		{[]string{"http", "v3"}, []string{"localhost:9999"}},
+	} {
+		b, err := newStaticBackend(target, log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		instancer, err := b.Instancer("addsvc", tc.tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events := make(chan sd.Event, 1)
+		instancer.Register(events)
+		if have := (<-events).Instances; !reflect.DeepEqual(have, tc.want) {
+			t.Errorf("tags %q: want %q, have %q", tc.tags, tc.want, have)
+		}
+	}
+}
+
+// TestStaticBackendRegisterOnly checks that a service can register with
+// an empty target, while finding instances still needs them.
+func TestStaticBackendRegisterOnly(t *testing.T) {
+	b, err := newStaticBackend("", log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Registrar(Registration{Name: "addsvc"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Instancer("addsvc", nil); err == nil {
+		t.Fatal("want an error for an instancer without instances")
+	}
+}
@@ -0,0 +1,113 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HTTPChecker expects a 2xx answer to a GET of url.
+func HTTPChecker(url string) Checker {
+	return CheckerFunc(func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("GET %s: %s", url, resp.Status)
+		}
+		return nil
+	})
+}
+
+// GRPCChecker queries the standard gRPC health service. target has the
+// "host:port/service" form Consul uses, the service part is optional.
+func GRPCChecker(target string) Checker {
+	addr, service := target, ""
+	if i := strings.Index(target, "/"); i >= 0 {
+		addr, service = target[:i], target[i+1:]
+	}
+	return CheckerFunc(func(ctx context.Context) error {
+		conn, err := grpc.DialContext(ctx, addr, grpc.WithInsecure(), grpc.WithBlock())
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		resp, err := grpc_health_v1.NewHealthClient(conn).Check(ctx, &grpc_health_v1.HealthCheckRequest{Service: service})
+		if err != nil {
+			return err
+		}
+		if resp.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+			return fmt.Errorf("%s: %s", target, resp.Status)
+		}
+		return nil
+	})
+}
+
+// DependencyChecker picks HTTPChecker for http(s) URLs and GRPCChecker for
+// everything else.
+func DependencyChecker(target string) Checker {
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		return HTTPChecker(target)
+	}
+	return GRPCChecker(target)
+}
+
+var ErrSaturated = errors.New("rate limiter saturated")
+
+// LimiterChecker fails once lim has had no token left at every check for at
+// least window, i.e. once the next request would have been rejected for a
+// while. A single request emptying a small bucket does not count.
+func LimiterChecker(lim *rate.Limiter, window time.Duration) Checker {
+	var (
+		mtx   sync.Mutex
+		since time.Time // zero while not saturated
+	)
+	return CheckerFunc(func(context.Context) error {
+		mtx.Lock()
+		defer mtx.Unlock()
+		now := time.Now()
+		switch {
+		case lim.TokensAt(now) >= 1:
+			since = time.Time{}
+		case since.IsZero():
+			since = now
+		case now.Sub(since) >= window:
+			return fmt.Errorf("%w for %v", ErrSaturated, now.Sub(since).Round(time.Second))
+		}
+		return nil
+	})
+}
+
+var ErrShuttingDown = errors.New("shutting down")
+
+// ShutdownChecker fails once Begin has been called.
+type ShutdownChecker struct {
+	shuttingDown int32
+}
+
+func (s *ShutdownChecker) Begin() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+}
+
+func (s *ShutdownChecker) Check(context.Context) error {
+	if atomic.LoadInt32(&s.shuttingDown) != 0 {
+		return ErrShuttingDown
+	}
+	return nil
+}
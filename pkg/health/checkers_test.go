@@ -0,0 +1,40 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestLimiterChecker(t *testing.T) {
+	const window = 20 * time.Millisecond
+	for _, tc := range []struct {
+		name  string
+		lim   *rate.Limiter
+		empty bool // before the checks
+		errs  []bool
+	}{
+		{"tokens left", rate.NewLimiter(rate.Every(time.Hour), 1), false, []bool{false, false}},
+		{"saturated", rate.NewLimiter(rate.Every(time.Hour), 1), true, []bool{false, true}},
+		{"refilled", rate.NewLimiter(rate.Every(window/2), 1), true, []bool{false, false}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.empty {
+				tc.lim.Allow()
+			}
+			c := LimiterChecker(tc.lim, window)
+			for i, wantErr := range tc.errs {
+				if i > 0 {
+					time.Sleep(window)
+				}
+				err := c.Check(context.Background())
+				if wantErr != errors.Is(err, ErrSaturated) || !wantErr && err != nil {
+					t.Fatalf("check %d: want error %v, have %v", i, wantErr, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,21 @@
+package health
+
+import (
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// GRPCUpdater returns a Watch listener that mirrors the readiness into the
+// serving status of services on s. The empty name stands for the server as a
+// whole.
+func GRPCUpdater(s *health.Server, services ...string) func(ready bool) {
+	return func(ready bool) {
+		status := grpc_health_v1.HealthCheckResponse_NOT_SERVING
+		if ready {
+			status = grpc_health_v1.HealthCheckResponse_SERVING
+		}
+		for _, service := range services {
+			s.SetServingStatus(service, status)
+		}
+	}
+}
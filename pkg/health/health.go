@@ -0,0 +1,204 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+// Checker reports a problem by returning an error.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CheckerFunc func(ctx context.Context) error
+
+func (f CheckerFunc) Check(ctx context.Context) error { return f(ctx) }
+
+// Kind tells what a failing check means. A failing liveness check means the
+// process is broken and should be restarted, a failing readiness check only
+// that it should not get traffic right now. Readiness includes liveness.
+type Kind string
+
+const (
+	Liveness  Kind = "liveness"
+	Readiness Kind = "readiness"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+type Result struct {
+	Kind      Kind      `json:"kind"`
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	Took      string    `json:"took"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+type check struct {
+	name    string
+	kind    Kind
+	checker Checker
+}
+
+// Health runs a set of checks periodically and keeps their latest results,
+// so that probes are cheap and listeners learn about changes right away.
+type Health struct {
+	interval time.Duration
+	timeout  time.Duration
+	logger   log.Logger
+
+	mtx       sync.Mutex
+	checks    []check
+	results   map[string]Result
+	ready     bool
+	listeners []func(ready bool)
+}
+
+func New(interval, timeout time.Duration, logger log.Logger) *Health {
+	return &Health{
+		interval: interval,
+		timeout:  timeout,
+		logger:   logger,
+		results:  map[string]Result{},
+	}
+}
+
+// Add registers a check. It is evaluated on the next Refresh.
+func (h *Health) Add(kind Kind, name string, c Checker) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+	h.checks = append(h.checks, check{name, kind, c})
+}
+
+// Watch calls f with the current readiness and again whenever it changes.
+func (h *Health) Watch(f func(ready bool)) {
+	h.mtx.Lock()
+	h.listeners = append(h.listeners, f)
+	ready := h.ready
+	h.mtx.Unlock()
+	f(ready)
+}
+
+// Run refreshes the results every interval until ctx is done.
+func (h *Health) Run(ctx context.Context) error {
+	t := time.NewTicker(h.interval)
+	defer t.Stop()
+	for {
+		h.Refresh(ctx)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Refresh runs all checks concurrently and notifies the listeners if the
+// readiness changed.
+func (h *Health) Refresh(ctx context.Context) {
+	h.mtx.Lock()
+	checks := append([]check(nil), h.checks...)
+	h.mtx.Unlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c check) {
+			defer wg.Done()
+			results[i] = h.run(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	h.mtx.Lock()
+	ready := true
+	for i, c := range checks {
+		prev, seen := h.results[c.name]
+		if results[i].Status != StatusOK {
+			ready = false
+		}
+		if !seen || prev.Status != results[i].Status {
+			h.logger.Log("check", c.name, "kind", c.kind, "status", results[i].Status, "err", results[i].Error)
+		}
+		h.results[c.name] = results[i]
+	}
+	changed := ready != h.ready
+	h.ready = ready
+	listeners := append([]func(ready bool){}, h.listeners...)
+	h.mtx.Unlock()
+
+	if changed {
+		for _, f := range listeners {
+			f(ready)
+		}
+	}
+}
+
+func (h *Health) run(ctx context.Context, c check) Result {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	begin := time.Now()
+	err := c.checker.Check(ctx)
+	r := Result{
+		Kind:      c.kind,
+		Status:    StatusOK,
+		CheckedAt: begin.UTC(),
+		Took:      time.Since(begin).String(),
+	}
+	if err != nil {
+		r.Status = StatusFail
+		r.Error = err.Error()
+	}
+	return r
+}
+
+// Report returns the latest results of all checks that matter for kind.
+// Checks that have not run yet count as failed.
+func (h *Health) Report(kind Kind) Report {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	report := Report{Status: StatusOK, Checks: map[string]Result{}}
+	for _, c := range h.checks {
+		if kind == Liveness && c.kind != Liveness {
+			continue
+		}
+		r, ok := h.results[c.name]
+		if !ok {
+			r = Result{Kind: c.kind, Status: StatusFail, Error: "not checked yet"}
+		}
+		if r.Status != StatusOK {
+			report.Status = StatusFail
+		}
+		report.Checks[c.name] = r
+	}
+	return report
+}
+
+// Handler serves the report for kind as JSON, with status 503 if any check
+// failed.
+func (h *Health) Handler(kind Kind) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		report := h.Report(kind)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if report.Status != StatusOK {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(report)
+	})
+}
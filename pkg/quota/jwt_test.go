@@ -0,0 +1,54 @@
+package quota
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+// signJWT returns a JWT with header and claims, signed with HS256 and
+// secret whatever the header says.
+func signJWT(header, claims string, secret []byte) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(header)) + "." + enc.EncodeToString([]byte(claims))
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTSubject(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Unix(1700000000, 0)
+	hs256 := `{"alg":"HS256","typ":"JWT"}`
+	for _, tc := range []struct {
+		name  string
+		token string
+		want  string
+	}{
+		{"valid", signJWT(hs256, `{"sub":"alice"}`, secret), "alice"},
+		{"valid until exp", signJWT(hs256, `{"sub":"alice","exp":1700000001,"nbf":1700000000}`, secret), "alice"},
+		{"expired", signJWT(hs256, `{"sub":"alice","exp":1700000000}`, secret), ""},
+		{"not yet valid", signJWT(hs256, `{"sub":"alice","nbf":1700000001}`, secret), ""},
+		{"other secret", signJWT(hs256, `{"sub":"alice"}`, []byte("other")), ""},
+		{"other algorithm", signJWT(`{"alg":"none"}`, `{"sub":"alice"}`, secret), ""},
+		{"no subject", signJWT(hs256, `{"exp":1800000000}`, secret), ""},
+		{"bad claims", signJWT(hs256, `{"sub":`, secret), ""},
+		{"two segments", "a.b", ""},
+		{"bad signature", signJWT(hs256, `{"sub":"alice"}`, secret)[:10] + ".e30.!!", ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sub, err := jwtSubject(tc.token, secret, now)
+			if tc.want == "" {
+				if err == nil {
+					t.Fatalf("want an error, have subject %q", sub)
+				}
+				return
+			}
+			if err != nil || sub != tc.want {
+				t.Fatalf("want %q, have %q, %v", tc.want, sub, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,505 @@
+// Package quota limits the requests of every client of the gateway on its
+// own, with a token bucket and a daily quota.
+package quota
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/go-kit/kit/metrics"
+	"github.com/go-kit/kit/ratelimit"
+	"github.com/gorilla/mux"
+	"github.com/maolonglong/microservices-example/pkg/addendpoint"
+	"github.com/maolonglong/microservices-example/pkg/addservice"
+	"github.com/maolonglong/microservices-example/pkg/addtransport"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+)
+
+// ErrQuotaExceeded rejects the requests of a client that used up its daily
+// quota. Those beyond its rate get ratelimit.ErrLimited.
+var ErrQuotaExceeded = addservice.RegisterError(addservice.ErrorSpec{
+	Err:        errors.New("daily quota exceeded"),
+	Reason:     "QUOTA_EXCEEDED",
+	HTTPStatus: http.StatusTooManyRequests,
+	GRPCCode:   codes.ResourceExhausted,
+})
+
+// Limit is what a client may use: Rate requests per second, up to Burst at
+// once, and DailyQuota requests per UTC day, without a quota if 0. Every
+// item of a batch or stream counts as a request.
+type Limit struct {
+	Rate       float64 `yaml:"rate"`
+	Burst      int     `yaml:"burst"`
+	DailyQuota int     `yaml:"daily_quota"`
+}
+
+func (l Limit) Validate() error {
+	if l.Rate <= 0 || l.Burst < 1 {
+		return errors.New("rate must be positive and burst at least 1")
+	}
+	if l.DailyQuota < 0 {
+		return errors.New("daily_quota must not be negative")
+	}
+	return nil
+}
+
+// Config tells how clients are told apart and what they may use.
+//
+// A client is known as "key:" followed by the name its API key maps to in
+// APIKeys, else as "jwt:" followed by the subject of its bearer JWT, if
+// JWTSecret is set and the token is signed with it (HS256), else as "ip:"
+// followed by its IP address. The last address of X-Forwarded-For is taken
+// as the latter if TrustForwardedFor, for gateways behind a proxy. Unknown
+// keys and invalid tokens are ignored. The prefixes keep a token from
+// passing for an API key or an address.
+//
+// Clients get their entry in Clients, or Default. Entries name API keys,
+// with or without the "key:" prefix; JWT subjects and addresses only match
+// entries that carry their "jwt:" or "ip:" prefix. At most MaxClients are
+// tracked, the least recently seen ones are forgotten first; 0 turns the
+// limits off. The state of clients is kept in memory by every gateway on
+// its own: a client that is forgotten, because enough others came after
+// it, or that reaches another gateway starts over with a full bucket and
+// quota. The limits are best effort, not an accounting of usage.
+//
+// The admin endpoint requires AdminToken as a bearer token, and is off
+// without one.
+type Config struct {
+	APIKeyHeader      string            `yaml:"api_key_header"`
+	APIKeys           map[string]string `yaml:"api_keys"`
+	JWTSecret         string            `yaml:"jwt_secret"`
+	TrustForwardedFor bool              `yaml:"trust_forwarded_for"`
+	Default           Limit             `yaml:"default"`
+	Clients           map[string]Limit  `yaml:"clients"`
+	MaxClients        int               `yaml:"max_clients"`
+	AdminToken        string            `yaml:"admin_token"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		APIKeyHeader: "X-API-Key",
+		Default:      Limit{Rate: 5, Burst: 10},
+		MaxClients:   100000,
+	}
+}
+
+func (c Config) Validate() error {
+	if c.APIKeyHeader == "" {
+		return errors.New("api_key_header must not be empty")
+	}
+	if err := c.Default.Validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for name, l := range c.Clients {
+		if err := l.Validate(); err != nil {
+			return fmt.Errorf("clients: %s: %w", name, err)
+		}
+	}
+	if c.MaxClients < 0 {
+		return errors.New("max_clients must not be negative")
+	}
+	return nil
+}
+
+func (c Config) limit(client string) Limit {
+	if l, ok := c.Clients[client]; ok {
+		return l
+	}
+	if name := strings.TrimPrefix(client, "key:"); name != client {
+		if l, ok := c.Clients[name]; ok {
+			return l
+		}
+	}
+	return c.Default
+}
+
+// Limiter enforces a Config.
+type Limiter struct {
+	mtx        sync.Mutex
+	cfg        Config
+	apiKeys    map[[sha256.Size]byte]string
+	clients    map[string]*list.Element
+	lru        *list.List // of *client, most recently seen first
+	rejections metrics.Counter
+	now        func() time.Time
+}
+
+type client struct {
+	name     string
+	limit    Limit
+	bucket   *rate.Limiter
+	day      string // the UTC day used counts requests of
+	used     int
+	lastSeen time.Time
+}
+
+// NewLimiter returns a Limiter counting the requests it rejects in
+// rejections, by reason.
+func NewLimiter(cfg Config, rejections metrics.Counter) *Limiter {
+	l := &Limiter{
+		clients:    map[string]*list.Element{},
+		lru:        list.New(),
+		rejections: rejections,
+		now:        time.Now,
+	}
+	l.Update(cfg)
+	return l
+}
+
+// Update applies cfg, keeping the tokens and usage of the clients.
+func (l *Limiter) Update(cfg Config) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.cfg = cfg
+	// API keys are looked up by hash, so that the time it takes does not
+	// tell how close a guess was.
+	l.apiKeys = make(map[[sha256.Size]byte]string, len(cfg.APIKeys))
+	for key, name := range cfg.APIKeys {
+		l.apiKeys[sha256.Sum256([]byte(key))] = name
+	}
+	now := l.now()
+	for elem := l.lru.Front(); elem != nil; elem = elem.Next() {
+		c := elem.Value.(*client)
+		c.limit = cfg.limit(c.name)
+		c.bucket.SetLimitAt(now, rate.Limit(c.limit.Rate))
+		c.bucket.SetBurstAt(now, c.limit.Burst)
+	}
+	l.evict()
+}
+
+func (l *Limiter) evict() {
+	for l.lru.Len() > l.cfg.MaxClients {
+		elem := l.lru.Back()
+		delete(l.clients, elem.Value.(*client).name)
+		l.lru.Remove(elem)
+	}
+}
+
+// identify returns the name of the client that sent r.
+func (l *Limiter) identify(r *http.Request, now time.Time) string {
+	if key := r.Header.Get(l.cfg.APIKeyHeader); key != "" {
+		if name, ok := l.apiKeys[sha256.Sum256([]byte(key))]; ok {
+			return "key:" + name
+		}
+	}
+	if l.cfg.JWTSecret != "" {
+		auth := r.Header.Get("Authorization")
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			if sub, err := jwtSubject(auth[7:], []byte(l.cfg.JWTSecret), now); err == nil {
+				return "jwt:" + sub
+			}
+		}
+	}
+	if l.cfg.TrustForwardedFor {
+		if v := r.Header.Values("X-Forwarded-For"); len(v) > 0 {
+			hops := strings.Split(v[len(v)-1], ",")
+			if ip := net.ParseIP(strings.TrimSpace(hops[len(hops)-1])); ip != nil {
+				return "ip:" + ip.String()
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// decision is where the client named client stands after a request:
+// allowed or rejected with err, and the tighter of its rate and quota,
+// which has remaining requests until reset.
+type decision struct {
+	client     string
+	err        error
+	retryAfter time.Duration
+	limit      int
+	remaining  int
+	reset      time.Duration
+}
+
+// allow decides on r, unless the limits are off.
+func (l *Limiter) allow(r *http.Request) (decision, bool) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.cfg.MaxClients == 0 {
+		return decision{}, false
+	}
+	now := l.now()
+	name := l.identify(r, now)
+	c := l.client(name, now)
+	c.lastSeen = now
+
+	untilTomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour).Sub(now)
+	if c.limit.DailyQuota > 0 && c.used >= c.limit.DailyQuota {
+		return decision{
+			err:        ErrQuotaExceeded,
+			retryAfter: untilTomorrow,
+			limit:      c.limit.DailyQuota,
+			reset:      untilTomorrow,
+		}, true
+	}
+	res := c.bucket.ReserveN(now, 1)
+	if delay := res.DelayFrom(now); delay > 0 {
+		res.CancelAt(now)
+		return decision{
+			err:        ratelimit.ErrLimited,
+			retryAfter: delay,
+			limit:      c.limit.Burst,
+			reset:      delay,
+		}, true
+	}
+	c.used++
+
+	tokens := c.bucket.TokensAt(now)
+	d := decision{
+		client:    name,
+		limit:     c.limit.Burst,
+		remaining: int(tokens),
+		reset:     time.Duration((float64(c.limit.Burst) - tokens) / c.limit.Rate * float64(time.Second)),
+	}
+	if left := c.limit.DailyQuota - c.used; c.limit.DailyQuota > 0 && left < d.remaining {
+		d = decision{client: name, limit: c.limit.DailyQuota, remaining: left, reset: untilTomorrow}
+	}
+	return d, true
+}
+
+// charge takes n more requests from the client of ctx, the one Handler let
+// its request through for, if any. Unless wait, it fails when the bucket
+// lacks the tokens; otherwise it waits for them, as long as ctx allows.
+// Batches larger than the burst never fit, and are rejected with
+// addendpoint.ErrBatchTooLarge.
+func (l *Limiter) charge(ctx context.Context, n int, wait bool) error {
+	name, ok := ctx.Value(clientContextKey).(string)
+	if !ok || n <= 0 {
+		return nil
+	}
+	delay, err := l.reserve(name, n, wait)
+	if err != nil {
+		l.rejections.With("reason", addservice.ErrorReason(err)).Add(1)
+		return err
+	}
+	if delay > 0 {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// reserve takes n requests from the client name and returns how long to
+// wait for them, for charge.
+func (l *Limiter) reserve(name string, n int, wait bool) (time.Duration, error) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	if l.cfg.MaxClients == 0 {
+		return 0, nil
+	}
+	now := l.now()
+	c := l.client(name, now)
+	// The request took a token already, so n more at once only fit below
+	// the burst.
+	if !wait && n >= c.limit.Burst {
+		return 0, fmt.Errorf("%w: %d items, at most %d at once for this client", addendpoint.ErrBatchTooLarge, n+1, c.limit.Burst)
+	}
+	if c.limit.DailyQuota > 0 && c.used+n > c.limit.DailyQuota {
+		return 0, ErrQuotaExceeded
+	}
+	res := c.bucket.ReserveN(now, n)
+	delay := res.DelayFrom(now)
+	if delay > 0 && !wait {
+		res.CancelAt(now)
+		return 0, ratelimit.ErrLimited
+	}
+	c.used += n
+	return delay, nil
+}
+
+// client returns the state of the client name, as of now.
+func (l *Limiter) client(name string, now time.Time) *client {
+	day := now.UTC().Format("2006-01-02")
+	if elem, ok := l.clients[name]; ok {
+		l.lru.MoveToFront(elem)
+		c := elem.Value.(*client)
+		if c.day != day {
+			c.day, c.used = day, 0
+		}
+		return c
+	}
+	limit := l.cfg.limit(name)
+	c := &client{
+		name:   name,
+		limit:  limit,
+		bucket: rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst),
+		day:    day,
+	}
+	l.clients[name] = l.lru.PushFront(c)
+	l.evict()
+	return c
+}
+
+type contextKey int
+
+const clientContextKey contextKey = iota
+
+// Handler enforces the limits on the requests next serves, and tells
+// clients where they stand with RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers. Rejected requests get a 429 with Retry-After.
+// Every request costs one, its further items are charged by
+// BatchMiddleware and StreamMiddleware.
+func (l *Limiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d, ok := l.allow(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		h := w.Header()
+		h.Set("RateLimit-Limit", strconv.Itoa(d.limit))
+		h.Set("RateLimit-Remaining", strconv.Itoa(d.remaining))
+		h.Set("RateLimit-Reset", seconds(d.reset))
+		if d.err != nil {
+			l.rejections.With("reason", addservice.ErrorReason(d.err)).Add(1)
+			h.Set("Retry-After", seconds(d.retryAfter))
+			addtransport.WriteError(w, r, d.err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), clientContextKey, d.client)))
+	})
+}
+
+// BatchMiddleware charges the client of a request for the items of its
+// batch, which items counts, but the first, paid for with the request. A
+// batch that does not fit in the bucket of the client right away is
+// rejected as a whole.
+func (l *Limiter) BatchMiddleware(items func(request interface{}) int) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			if err := l.charge(ctx, items(request)-1, false); err != nil {
+				return nil, err
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// StreamMiddleware charges the client of a stream, see addendpoint.Stream,
+// for its items but the first, paid for with the request, as they arrive.
+// Items wait for their tokens instead of being rejected, as they do in
+// addsvc, while an exhausted daily quota ends the stream.
+func (l *Limiter) StreamMiddleware() endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			s := request.(addendpoint.Stream)
+			recv, first := s.Recv, true
+			s.Recv = func() (interface{}, error) {
+				req, err := recv()
+				if err != nil || first {
+					first = false
+					return req, err
+				}
+				if err := l.charge(ctx, 1, true); err != nil {
+					return nil, err
+				}
+				return req, nil
+			}
+			return next(ctx, s)
+		}
+	}
+}
+
+// seconds rounds d up to whole seconds.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Usage is where a client stands.
+type Usage struct {
+	Client     string    `json:"client"`
+	Rate       float64   `json:"rate"`
+	Burst      int       `json:"burst"`
+	Tokens     float64   `json:"tokens"`
+	DailyQuota int       `json:"daily_quota,omitempty"`
+	UsedToday  int       `json:"used_today"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// Usage returns the usage of the clients being tracked, by name.
+func (l *Limiter) Usage() []Usage {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	now := l.now()
+	day := now.UTC().Format("2006-01-02")
+	usage := make([]Usage, 0, l.lru.Len())
+	for elem := l.lru.Front(); elem != nil; elem = elem.Next() {
+		c := elem.Value.(*client)
+		u := Usage{
+			Client:     c.name,
+			Rate:       c.limit.Rate,
+			Burst:      c.limit.Burst,
+			Tokens:     c.bucket.TokensAt(now),
+			DailyQuota: c.limit.DailyQuota,
+			LastSeen:   c.lastSeen,
+		}
+		if c.day == day {
+			u.UsedToday = c.used
+		}
+		usage = append(usage, u)
+	}
+	sort.Slice(usage, func(i, j int) bool { return usage[i].Client < usage[j].Client })
+	return usage
+}
+
+// AdminHandler serves the Usage of all clients, or of the one named by the
+// "client" route variable, as JSON. It answers 404 while no AdminToken is
+// configured.
+func (l *Limiter) AdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l.mtx.Lock()
+		token := l.cfg.AdminToken
+		l.mtx.Unlock()
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		var v interface{} = l.Usage()
+		if name, ok := mux.Vars(r)["client"]; ok {
+			v = nil
+			for _, u := range l.Usage() {
+				if u.Client == name {
+					v = u
+					break
+				}
+			}
+			if v == nil {
+				http.Error(w, "unknown client", http.StatusNotFound)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(v)
+	})
+}
@@ -0,0 +1,175 @@
+package quota
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-kit/kit/metrics/discard"
+	"github.com/gorilla/mux"
+)
+
+func TestHandler(t *testing.T) {
+	type step struct {
+		advance   time.Duration // before the request
+		status    int
+		reason    string
+		limit     string
+		remaining string
+		reset     string
+		retry     string
+	}
+	for _, tc := range []struct {
+		name  string
+		start time.Time
+		limit Limit
+		steps []step
+	}{
+		{"bucket", time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), Limit{Rate: 1, Burst: 2}, []step{
+			{status: 200, limit: "2", remaining: "1", reset: "1"},
+			{status: 200, limit: "2", remaining: "0", reset: "2"},
+			{status: 429, reason: "RATE_LIMITED", limit: "2", remaining: "0", reset: "1", retry: "1"},
+			{advance: 500 * time.Millisecond, status: 429, reason: "RATE_LIMITED", limit: "2", remaining: "0", reset: "1", retry: "1"},
+			{advance: 500 * time.Millisecond, status: 200, limit: "2", remaining: "0", reset: "2"},
+			{advance: 5 * time.Second, status: 200, limit: "2", remaining: "1", reset: "1"},
+		}},
+		{"daily quota", time.Date(2024, 1, 1, 23, 59, 0, 0, time.UTC), Limit{Rate: 100, Burst: 100, DailyQuota: 2}, []step{
+			{status: 200, limit: "2", remaining: "1", reset: "60"},
+			{status: 200, limit: "2", remaining: "0", reset: "60"},
+			{status: 429, reason: "QUOTA_EXCEEDED", limit: "2", remaining: "0", reset: "60", retry: "60"},
+			{advance: 30 * time.Second, status: 429, reason: "QUOTA_EXCEEDED", limit: "2", remaining: "0", reset: "30", retry: "30"},
+			{advance: 31 * time.Second, status: 200, limit: "2", remaining: "1", reset: "86399"},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.Default = tc.limit
+			l := NewLimiter(cfg, discard.NewCounter())
+			now := tc.start
+			l.now = func() time.Time { return now }
+			h := l.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+			for i, s := range tc.steps {
+				now = now.Add(s.advance)
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/sum", nil))
+				if w.Code != s.status {
+					t.Fatalf("request %d: want status %d, have %d", i, s.status, w.Code)
+				}
+				var body struct{ Reason string }
+				json.NewDecoder(w.Body).Decode(&body)
+				if body.Reason != s.reason {
+					t.Fatalf("request %d: want reason %q, have %q", i, s.reason, body.Reason)
+				}
+				for name, want := range map[string]string{
+					"RateLimit-Limit":     s.limit,
+					"RateLimit-Remaining": s.remaining,
+					"RateLimit-Reset":     s.reset,
+					"Retry-After":         s.retry,
+				} {
+					if have := w.Header().Get(name); have != want {
+						t.Fatalf("request %d: want %s %q, have %q", i, name, want, have)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIdentify(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.APIKeys = map[string]string{"k1": "alice"}
+	cfg.JWTSecret = "secret"
+	token := signJWT(`{"alg":"HS256"}`, `{"sub":"bob"}`, []byte(cfg.JWTSecret))
+	for _, tc := range []struct {
+		name      string
+		header    http.Header
+		forwarded bool
+		want      string
+	}{
+		{"address", nil, false, "ip:192.0.2.1"},
+		{"api key", http.Header{"X-Api-Key": {"k1"}}, false, "key:alice"},
+		{"unknown api key", http.Header{"X-Api-Key": {"k2"}}, false, "ip:192.0.2.1"},
+		{"jwt", http.Header{"Authorization": {"Bearer " + token}}, false, "jwt:bob"},
+		{"invalid jwt", http.Header{"Authorization": {"Bearer " + token + "x"}}, false, "ip:192.0.2.1"},
+		{"api key first", http.Header{"X-Api-Key": {"k1"}, "Authorization": {"Bearer " + token}}, false, "key:alice"},
+		{"forwarded", http.Header{"X-Forwarded-For": {"198.51.100.1, 198.51.100.2"}}, true, "ip:198.51.100.2"},
+		{"forwarded untrusted", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, false, "ip:192.0.2.1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := cfg
+			cfg.TrustForwardedFor = tc.forwarded
+			l := NewLimiter(cfg, discard.NewCounter())
+			r := httptest.NewRequest(http.MethodPost, "/v1/sum", nil)
+			for k, v := range tc.header {
+				r.Header[k] = v
+			}
+			if have := l.identify(r, time.Now()); have != tc.want {
+				t.Fatalf("want %q, have %q", tc.want, have)
+			}
+		})
+	}
+}
+
+func TestConfigLimit(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Clients = map[string]Limit{
+		"alice":        {Rate: 1, Burst: 1},
+		"key:bob":      {Rate: 2, Burst: 2},
+		"jwt:carol":    {Rate: 3, Burst: 3},
+		"ip:192.0.2.1": {Rate: 4, Burst: 4},
+	}
+	for client, want := range map[string]Limit{
+		"key:alice":     cfg.Clients["alice"],
+		"key:bob":       cfg.Clients["key:bob"],
+		"jwt:carol":     cfg.Clients["jwt:carol"],
+		"ip:192.0.2.1":  cfg.Clients["ip:192.0.2.1"],
+		"jwt:alice":     cfg.Default,
+		"key:carol":     cfg.Default,
+		"jwt:192.0.2.1": cfg.Default,
+		"ip:192.0.2.2":  cfg.Default,
+	} {
+		if have := cfg.limit(client); have != want {
+			t.Errorf("%s: want %+v, have %+v", client, want, have)
+		}
+	}
+}
+
+func TestAdminHandler(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		token  string
+		auth   string
+		path   string
+		status int
+	}{
+		{"off without token", "", "", "/admin/clients", http.StatusNotFound},
+		{"no credentials", "t0k", "", "/admin/clients", http.StatusUnauthorized},
+		{"wrong token", "t0k", "Bearer nope", "/admin/clients", http.StatusUnauthorized},
+		{"all clients", "t0k", "Bearer t0k", "/admin/clients", http.StatusOK},
+		{"one client", "t0k", "Bearer t0k", "/admin/clients/ip:192.0.2.1", http.StatusOK},
+		{"unknown client", "t0k", "Bearer t0k", "/admin/clients/ip:192.0.2.9", http.StatusNotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.AdminToken = tc.token
+			l := NewLimiter(cfg, discard.NewCounter())
+			l.Handler(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			r := mux.NewRouter()
+			r.Path("/admin/clients").Handler(l.AdminHandler())
+			r.Path("/admin/clients/{client}").Handler(l.AdminHandler())
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tc.status {
+				t.Fatalf("want status %d, have %d", tc.status, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/maolonglong/microservices-example/pkg/health"
+)
+
+// check runs all health checks of in and returns the first failure.
+func check(ctx context.Context, in Instance) error {
+	if in.HealthHTTP != "" {
+		if err := health.HTTPChecker(in.HealthHTTP).Check(ctx); err != nil {
+			return err
+		}
+	}
+	if in.HealthGRPC != "" {
+		if err := health.GRPCChecker(in.HealthGRPC).Check(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
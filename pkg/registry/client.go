@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client talks to a registry served by NewHTTPHandler.
+type Client struct {
+	base   *url.URL
+	client *http.Client
+}
+
+func NewClient(addr string) (*Client, error) {
+	if !strings.HasPrefix(addr, "http") {
+		addr = "http://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{base: u, client: &http.Client{}}, nil
+}
+
+func (c *Client) Register(ctx context.Context, in Instance) error {
+	return c.do(ctx, http.MethodPut, "/v1/instances/"+url.PathEscape(in.ID), nil, in, nil)
+}
+
+func (c *Client) Deregister(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/v1/instances/"+url.PathEscape(id), nil, nil, nil)
+}
+
+func (c *Client) Heartbeat(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodPut, "/v1/instances/"+url.PathEscape(id)+"/heartbeat", nil, nil, nil)
+}
+
+// Watch blocks until service changed after index, or wait elapsed. Only
+// healthy instances carrying all of tags are returned.
+func (c *Client) Watch(ctx context.Context, service string, tags []string, index uint64, wait time.Duration) (Snapshot, error) {
+	q := url.Values{"tag": tags}
+	q.Set("index", strconv.FormatUint(index, 10))
+	q.Set("wait", wait.String())
+	var snapshot Snapshot
+	err := c.do(ctx, http.MethodGet, "/v1/services/"+url.PathEscape(service), q, nil, &snapshot)
+	return snapshot, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body, result interface{}) error {
+	u := *c.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	u.RawQuery = query.Encode()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), &buf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= 300:
+		var w errorWrapper
+		json.NewDecoder(resp.Body).Decode(&w)
+		return fmt.Errorf("registry: %s: %s", resp.Status, w.Error)
+	case result != nil:
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/log"
+	"github.com/gorilla/mux"
+)
+
+const (
+	defaultWait = 30 * time.Second
+	maxWait     = 5 * time.Minute
+)
+
+// Snapshot is the answer to a watch: the instances of a service as of Index.
+type Snapshot struct {
+	Index     uint64     `json:"index"`
+	Instances []Instance `json:"instances"`
+}
+
+// NewHTTPHandler exposes r over HTTP/JSON:
+//
+//	PUT    /v1/instances/{id}            register, body is an Instance
+//	DELETE /v1/instances/{id}            deregister
+//	PUT    /v1/instances/{id}/heartbeat  renew the TTL
+//	GET    /v1/services                  list service names
+//	GET    /v1/services/{service}        list instances, see below
+//
+// The instance list only contains healthy instances unless passing=false is
+// given, and only instances carrying every tag given as tag=... parameters.
+// With index=N it blocks until the service changed after N, or until wait
+// (a Go duration, 30s by default) elapsed.
+func NewHTTPHandler(r *Registry, logger log.Logger) http.Handler {
+	m := mux.NewRouter()
+
+	m.Methods(http.MethodPut).Path("/v1/instances/{id}").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var in Instance
+		if err := json.NewDecoder(req.Body).Decode(&in); err != nil {
+			encodeError(w, err, http.StatusBadRequest)
+			return
+		}
+		in.ID = mux.Vars(req)["id"]
+		if err := r.Register(in); err != nil {
+			encodeError(w, err, errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	m.Methods(http.MethodDelete).Path("/v1/instances/{id}").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := r.Deregister(mux.Vars(req)["id"]); err != nil {
+			encodeError(w, err, errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	m.Methods(http.MethodPut).Path("/v1/instances/{id}/heartbeat").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err := r.Heartbeat(mux.Vars(req)["id"]); err != nil {
+			encodeError(w, err, errorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	m.Methods(http.MethodGet).Path("/v1/services").HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		encodeJSON(w, r.Services())
+	})
+
+	m.Methods(http.MethodGet).Path("/v1/services/{service}").HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		q := req.URL.Query()
+		var index uint64
+		if s := q.Get("index"); s != "" {
+			var err error
+			if index, err = strconv.ParseUint(s, 10, 64); err != nil {
+				encodeError(w, err, http.StatusBadRequest)
+				return
+			}
+		}
+		wait := defaultWait
+		if s := q.Get("wait"); s != "" {
+			var err error
+			if wait, err = time.ParseDuration(s); err != nil {
+				encodeError(w, err, http.StatusBadRequest)
+				return
+			}
+		}
+		if wait > maxWait {
+			wait = maxWait
+		}
+		passingOnly := q.Get("passing") != "false"
+		tags := q["tag"]
+
+		ctx, cancel := context.WithTimeout(req.Context(), wait)
+		defer cancel()
+		index, instances := r.Watch(ctx, mux.Vars(req)["service"], index)
+
+		snapshot := Snapshot{Index: index, Instances: []Instance{}}
+		for _, in := range instances {
+			if (in.Healthy || !passingOnly) && in.HasTags(tags) {
+				snapshot.Instances = append(snapshot.Instances, in)
+			}
+		}
+		encodeJSON(w, snapshot)
+	})
+
+	m.Methods(http.MethodGet).Path("/health").HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"status":"ok"}`))
+	})
+
+	return m
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidInstance):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+type errorWrapper struct {
+	Error string `json:"error"`
+}
+
+func encodeError(w http.ResponseWriter, err error, code int) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(errorWrapper{Error: err.Error()})
+}
+
+func encodeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,305 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/log"
+)
+
+const DefaultTTL = 15 * time.Second
+
+var (
+	ErrNotFound        = errors.New("instance not found")
+	ErrInvalidInstance = errors.New("instance needs an id, a service, an address and a port")
+)
+
+// Instance is a registered service instance. It stays registered as long as
+// it sends a heartbeat at least every TTLSeconds, and it is only handed out as
+// healthy while its health checks pass.
+type Instance struct {
+	ID         string            `json:"id"`
+	Service    string            `json:"service"`
+	Address    string            `json:"address"`
+	Port       int               `json:"port"`
+	Tags       []string          `json:"tags,omitempty"`
+	Meta       map[string]string `json:"meta,omitempty"`
+	TTLSeconds int               `json:"ttl_seconds,omitempty"`
+	HealthHTTP string            `json:"health_http,omitempty"`
+	HealthGRPC string            `json:"health_grpc,omitempty"`
+	Healthy    bool              `json:"healthy"`
+}
+
+// HasTags reports whether in carries all of tags.
+func (in Instance) HasTags(tags []string) bool {
+	for _, t := range tags {
+		found := false
+		for _, have := range in.Tags {
+			if have == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// TTL returns how long the instance stays registered without a heartbeat.
+func (in Instance) TTL() time.Duration {
+	if in.TTLSeconds <= 0 {
+		return DefaultTTL
+	}
+	return time.Duration(in.TTLSeconds) * time.Second
+}
+
+func (in Instance) hasChecks() bool {
+	return in.HealthHTTP != "" || in.HealthGRPC != ""
+}
+
+type entry struct {
+	Instance
+	expires time.Time
+}
+
+// Registry is an in-memory service registry. Every change to a service bumps
+// a global index, which Watch uses to implement blocking queries.
+type Registry struct {
+	mtx      sync.Mutex
+	entries  map[string]*entry
+	services map[string]uint64
+	index    uint64
+	changed  chan struct{}
+
+	checkInterval time.Duration
+	checkTimeout  time.Duration
+	logger        log.Logger
+	quit          chan struct{}
+	done          chan struct{}
+}
+
+// New returns a registry that expires instances after their TTL and runs
+// their health checks every checkInterval. Call Stop to release it.
+func New(checkInterval, checkTimeout time.Duration, logger log.Logger) *Registry {
+	r := &Registry{
+		entries:  map[string]*entry{},
+		services: map[string]uint64{},
+		// Index 1 is reserved for "nothing happened yet", so that a
+		// watch on an unknown service blocks until it shows up.
+		index:         1,
+		changed:       make(chan struct{}),
+		checkInterval: checkInterval,
+		checkTimeout:  checkTimeout,
+		logger:        logger,
+		quit:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go r.loop()
+	return r
+}
+
+func (r *Registry) Stop() {
+	close(r.quit)
+	<-r.done
+}
+
+// Register adds or replaces an instance. Instances without health checks are
+// healthy right away, all others once their first check passed.
+func (r *Registry) Register(in Instance) error {
+	if in.ID == "" || in.Service == "" || in.Address == "" || in.Port <= 0 {
+		return ErrInvalidInstance
+	}
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	old, exists := r.entries[in.ID]
+	in.Healthy = !in.hasChecks()
+	if exists && old.HealthHTTP == in.HealthHTTP && old.HealthGRPC == in.HealthGRPC {
+		in.Healthy = old.Healthy
+	}
+	r.entries[in.ID] = &entry{Instance: in, expires: time.Now().Add(in.TTL())}
+	if exists && old.Service != in.Service {
+		r.bump(old.Service)
+	}
+	if !exists || !reflect.DeepEqual(old.Instance, in) {
+		r.bump(in.Service)
+		r.logger.Log("action", "register", "service", in.Service, "id", in.ID)
+	}
+	if in.hasChecks() {
+		go r.checkOne(in)
+	}
+	return nil
+}
+
+func (r *Registry) Deregister(id string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	e, ok := r.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(r.entries, id)
+	r.bump(e.Service)
+	r.logger.Log("action", "deregister", "service", e.Service, "id", id)
+	return nil
+}
+
+// Heartbeat renews the TTL of an instance. ErrNotFound tells the caller that
+// the instance expired and has to register again.
+func (r *Registry) Heartbeat(id string) error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	e, ok := r.entries[id]
+	if !ok {
+		return ErrNotFound
+	}
+	e.expires = time.Now().Add(e.TTL())
+	return nil
+}
+
+// Services returns the names of all services with at least one instance.
+func (r *Registry) Services() []string {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	seen := map[string]bool{}
+	var names []string
+	for _, e := range r.entries {
+		if !seen[e.Service] {
+			seen[e.Service] = true
+			names = append(names, e.Service)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Watch returns the instances of service once its index is greater than
+// index, or the current state when ctx is done first. Pass 0 to return
+// immediately.
+func (r *Registry) Watch(ctx context.Context, service string, index uint64) (uint64, []Instance) {
+	for {
+		r.mtx.Lock()
+		current := r.serviceIndex(service)
+		if current > index || ctx.Err() != nil {
+			instances := r.instances(service)
+			r.mtx.Unlock()
+			return current, instances
+		}
+		changed := r.changed
+		r.mtx.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+		}
+	}
+}
+
+func (r *Registry) serviceIndex(service string) uint64 {
+	if index, ok := r.services[service]; ok {
+		return index
+	}
+	return 1
+}
+
+func (r *Registry) instances(service string) []Instance {
+	var instances []Instance
+	for _, e := range r.entries {
+		if e.Service == service {
+			instances = append(instances, e.Instance)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].ID < instances[j].ID })
+	return instances
+}
+
+// bump must be called with r.mtx held.
+func (r *Registry) bump(service string) {
+	r.index++
+	r.services[service] = r.index
+	close(r.changed)
+	r.changed = make(chan struct{})
+}
+
+func (r *Registry) loop() {
+	defer close(r.done)
+
+	expire := time.NewTicker(time.Second)
+	defer expire.Stop()
+	check := time.NewTicker(r.checkInterval)
+	defer check.Stop()
+
+	for {
+		select {
+		case now := <-expire.C:
+			r.expire(now)
+		case <-check.C:
+			r.checkAll()
+		case <-r.quit:
+			return
+		}
+	}
+}
+
+func (r *Registry) expire(now time.Time) {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	for id, e := range r.entries {
+		if now.After(e.expires) {
+			delete(r.entries, id)
+			r.bump(e.Service)
+			r.logger.Log("action", "expire", "service", e.Service, "id", id)
+		}
+	}
+}
+
+func (r *Registry) checkAll() {
+	r.mtx.Lock()
+	var instances []Instance
+	for _, e := range r.entries {
+		if e.hasChecks() {
+			instances = append(instances, e.Instance)
+		}
+	}
+	r.mtx.Unlock()
+
+	var wg sync.WaitGroup
+	for _, in := range instances {
+		wg.Add(1)
+		go func(in Instance) {
+			defer wg.Done()
+			r.checkOne(in)
+		}(in)
+	}
+	wg.Wait()
+}
+
+func (r *Registry) checkOne(in Instance) {
+	ctx, cancel := context.WithTimeout(context.Background(), r.checkTimeout)
+	defer cancel()
+	err := check(ctx, in)
+
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	e, ok := r.entries[in.ID]
+	if !ok || e.HealthHTTP != in.HealthHTTP || e.HealthGRPC != in.HealthGRPC {
+		return
+	}
+	if healthy := err == nil; e.Healthy != healthy {
+		e.Healthy = healthy
+		r.bump(e.Service)
+		r.logger.Log("action", "check", "service", e.Service, "id", e.ID, "healthy", healthy, "err", err)
+	}
+}